@@ -0,0 +1,296 @@
+// Milidbg is an interactive step debugger for MiLisp programs.
+//
+// Usage:
+//
+//	milidbg [flags] path
+//
+// It evaluates the program with the operations from examples: prog, set, loop, def, call,
+// if_gt_one, +, -, *, / and print. Evaluation pauses at the first expression.
+// Flags:
+//
+//	-var name=value  set variable, value is MiLisp expression like 5 or "text" (repeatable)
+//	-break spec      add breakpoint: line, line:column or operation name (repeatable)
+//
+// Commands at pause (empty line repeats the last one):
+//
+//	s, step          step into
+//	n, next          step over
+//	o, out           step out
+//	c, continue      run up to the next breakpoint
+//	b spec           add breakpoint
+//	d spec           delete breakpoint
+//	bl               list breakpoints
+//	l, where         print the current expression and its location
+//	p name           print variable
+//	vars             list variables and operations
+//	set name expr    evaluate expression and assign result to variable
+//	e expr           evaluate expression and print result
+//	q, quit          stop evaluation
+//	h, help          print commands
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+const help = `s, step          step into
+n, next          step over
+o, out           step out
+c, continue      run up to the next breakpoint
+b spec           add breakpoint: line, line:column or operation name
+d spec           delete breakpoint
+bl               list breakpoints
+l, where         print the current expression and its location
+p name           print variable
+vars             list variables and operations
+set name expr    evaluate expression and assign result to variable
+e expr           evaluate expression and print result
+q, quit          stop evaluation
+h, help          print commands`
+
+type multiFlag []string
+
+func (f *multiFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *multiFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+type session struct {
+	in      *bufio.Scanner
+	out     io.Writer
+	source  string
+	lines   []string
+	dbg     *milisp.Debugger
+	pause   *milisp.Pause
+	lastCmd string
+}
+
+func breakpoint(spec, source string) milisp.Breakpoint {
+	parts := strings.SplitN(spec, ":", 2)
+	line, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return milisp.Breakpoint{Op: spec}
+	}
+	b := milisp.Breakpoint{Source: source, Line: line}
+	if len(parts) == 2 {
+		b.Column, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return milisp.Breakpoint{Op: spec}
+		}
+	}
+	return b
+}
+
+// where prints location of expression and source line with marker.
+func (s *session) where() {
+	n := s.pause.Node
+	pos := n.Position()
+	reason := ""
+	if s.pause.Breakpoint != nil {
+		reason = " by breakpoint " + s.pause.Breakpoint.String()
+	}
+	fmt.Fprintf(s.out, "paused at %s:%s%s\n", s.source, pos, reason)
+	if pos.Line >= 1 && pos.Line <= len(s.lines) {
+		line := s.lines[pos.Line-1]
+		marker := []rune(nil)
+		for i, ch := range []rune(line) {
+			if i+1 >= n.Span().Start.Column {
+				break
+			}
+			if ch != '\t' {
+				ch = ' '
+			}
+			marker = append(marker, ch)
+		}
+		fmt.Fprintf(s.out, "%5d | %s\n      | %s^\n", pos.Line, line, string(marker))
+	}
+	text, err := milisp.Format(n)
+	if err != nil {
+		text = fmt.Sprint(n)
+	}
+	fmt.Fprintln(s.out, text)
+}
+
+func show(v interface{}) string {
+	switch x := v.(type) {
+	case milisp.Operation:
+		return "operation"
+	case string:
+		return strconv.Quote(x)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// eval evaluates expression in new scope of the environment of pause. It is evaluated by Eval,
+// so debugger doesn't pause in it and the pause is kept; variables that it sets are dropped with scope.
+func (s *session) eval(text string) (interface{}, error) {
+	e, err := milisp.Compile(text)
+	if err != nil {
+		return nil, err
+	}
+	return e.Eval(milisp.NewScope(s.pause.Env))
+}
+
+func (s *session) command(line string) (milisp.DebugCommand, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	arg := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+	switch fields[0] {
+	case "s", "step":
+		return milisp.DebugStepInto, true
+	case "n", "next":
+		return milisp.DebugStepOver, true
+	case "o", "out":
+		return milisp.DebugStepOut, true
+	case "c", "continue":
+		return milisp.DebugContinue, true
+	case "q", "quit":
+		return milisp.DebugStop, true
+	case "b":
+		s.dbg.AddBreakpoint(breakpoint(arg, s.source))
+	case "d":
+		s.dbg.RemoveBreakpoint(breakpoint(arg, s.source))
+	case "bl":
+		for _, b := range s.dbg.Breakpoints() {
+			fmt.Fprintln(s.out, b)
+		}
+	case "l", "where":
+		s.where()
+	case "p":
+		v, ok := s.pause.Env.Lookup(arg)
+		if !ok {
+			fmt.Fprintf(s.out, "%s is not defined\n", arg)
+			break
+		}
+		fmt.Fprintf(s.out, "%s = %s\n", arg, show(v))
+	case "vars":
+		for _, k := range s.pause.Names() {
+			v, _ := s.pause.Env.Lookup(k)
+			fmt.Fprintf(s.out, "%s = %s\n", k, show(v))
+		}
+	case "set":
+		if len(fields) < 3 {
+			fmt.Fprintln(s.out, "usage: set name expr")
+			break
+		}
+		v, err := s.eval(strings.TrimSpace(strings.TrimPrefix(arg, fields[1])))
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			break
+		}
+		s.pause.Env.SetOuter(fields[1], v)
+	case "e":
+		v, err := s.eval(arg)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			break
+		}
+		fmt.Fprintln(s.out, show(v))
+	default:
+		fmt.Fprintln(s.out, help)
+	}
+	return 0, false
+}
+
+// onPause interacts with user up to the command that resumes evaluation.
+func (s *session) onPause(p *milisp.Pause) milisp.DebugCommand {
+	s.pause = p
+	s.where()
+	for {
+		fmt.Fprint(s.out, "(milidbg) ")
+		if !s.in.Scan() {
+			fmt.Fprintln(s.out)
+			return milisp.DebugStop
+		}
+		line := s.in.Text()
+		if strings.TrimSpace(line) == "" {
+			line = s.lastCmd
+		}
+		s.lastCmd = line
+		if c, ok := s.command(line); ok {
+			return c
+		}
+	}
+}
+
+func run(args []string, in io.Reader, out, errOut io.Writer) int {
+	vars := multiFlag{}
+	breaks := multiFlag{}
+	flags := flag.NewFlagSet("milidbg", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.Var(&vars, "var", "set variable: name=value, value is MiLisp expression (repeatable)")
+	flags.Var(&breaks, "break", "add breakpoint: line, line:column or operation name (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(errOut, "usage: milidbg [flags] path")
+		return 2
+	}
+	name := flags.Arg(0)
+	src, err := os.ReadFile(name) //nolint:gosec // file name comes from user
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	expr, err := milisp.CompileProgram(string(src), milisp.WithSourceName(name))
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	env := environment(out)
+	for _, v := range vars {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			fmt.Fprintf(errOut, "invalid variable %q: name=value expected\n", v)
+			return 2
+		}
+		env[parts[0]], err = milisp.EvalCode(env, parts[1])
+		if err != nil {
+			fmt.Fprintf(errOut, "invalid variable %q: %s\n", v, err)
+			return 2
+		}
+	}
+	s := &session{
+		in:     bufio.NewScanner(in),
+		out:    out,
+		source: name,
+		lines:  strings.Split(string(src), "\n"),
+	}
+	s.dbg = milisp.NewDebugger(s.onPause)
+	for _, b := range breaks {
+		s.dbg.AddBreakpoint(breakpoint(b, name))
+	}
+	res, err := milisp.EvalContext(context.Background(), env, expr, milisp.WithDebugger(s.dbg))
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(out, "stopped")
+			return 1
+		}
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	fmt.Fprintf(out, "result: %v\n", res)
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "x.lisp")
+	err := os.WriteFile(name, []byte("(prog\n  (set x 2)\n  (print (+ x N)))\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := []string{
+		"c",
+		"e (prog (set x 100) (+ x N))", // neither pauses nor changes variables
+		"p x",
+		"set x (+ x 1)",
+		"p x",
+		"where",
+		"c",
+	}
+	out := strings.Builder{}
+	errOut := strings.Builder{}
+	code := run([]string{"-var", "N=5", "-break", "print", name}, strings.NewReader(strings.Join(commands, "\n")), &out, &errOut)
+	if code != 0 || errOut.Len() != 0 {
+		t.Errorf("Unexpected exit: %d: %s", code, errOut.String())
+	}
+	where := "paused at " + name + ":1:1\n" +
+		"    1 | (prog\n" +
+		"      | ^\n" +
+		"(prog (set x 2) (print (+ x N)))\n"
+	pause := "paused at " + name + ":3:3 by breakpoint (print ...)\n" +
+		"    3 |   (print (+ x N)))\n" +
+		"      |   ^\n" +
+		"(print (+ x N))\n"
+	expected := where +
+		"(milidbg) " + pause +
+		"(milidbg) 105\n" +
+		"(milidbg) x = 2\n" +
+		"(milidbg) (milidbg) x = 3\n" +
+		"(milidbg) " + pause +
+		"(milidbg) 8\n" +
+		"result: <nil>\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
+
+func TestRun_errors(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"no file", nil, "usage: milidbg [flags] path\n"},
+		{"bad flag", []string{"-x"}, "flag provided but not defined: -x\n"},
+		{"bad var", []string{"-var", "N", "x.lisp"}, "invalid variable \"N\": name=value expected\n"},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, "x.lisp"), []byte("1"), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := c.args
+			for i, a := range args {
+				if a == "x.lisp" {
+					args[i] = filepath.Join(dir, a)
+				}
+			}
+			out := strings.Builder{}
+			errOut := strings.Builder{}
+			code := run(args, strings.NewReader(""), &out, &errOut)
+			if code != 2 || !strings.HasPrefix(errOut.String(), c.err) {
+				t.Errorf("Unexpected exit: %d: %q", code, errOut.String())
+			}
+		})
+	}
+}
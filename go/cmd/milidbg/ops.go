@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+// Operations are taken from examples of package milisp.
+
+func checkArgs(args []milisp.Expression, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("%d arguments expected, got %d", n, len(args))
+	}
+	return nil
+}
+
+func opProg(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+	res := interface{}(nil)
+	for _, a := range args {
+		var err error
+		res, err = milisp.EvalContext(ctx, env, a)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func opSet(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return nil, err
+	}
+	name, err := milisp.SymbolName(args[0])
+	if err != nil {
+		return nil, err
+	}
+	value, err := milisp.EvalContext(ctx, env, args[1])
+	if err != nil {
+		return nil, err
+	}
+	env.Set(name, value)
+	return nil, nil
+}
+
+func opLoop(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+	if err := checkArgs(args, 4); err != nil {
+		return nil, err
+	}
+	name, err := milisp.SymbolName(args[0])
+	if err != nil {
+		return nil, err
+	}
+	first, err := milisp.EvalFloatContext(ctx, env, args[1])
+	if err != nil {
+		return nil, err
+	}
+	last, err := milisp.EvalFloatContext(ctx, env, args[2])
+	if err != nil {
+		return nil, err
+	}
+	for i := int(first); i <= int(last); i++ {
+		env.Set(name, float64(i))
+		_, err = milisp.EvalContext(ctx, env, args[3])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func opIfGtOne(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+	if err := checkArgs(args, 3); err != nil {
+		return nil, err
+	}
+	value, err := milisp.EvalFloatContext(ctx, env, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if value > 1 {
+		return milisp.EvalContext(ctx, env, args[1])
+	}
+	return milisp.EvalContext(ctx, env, args[2])
+}
+
+type function struct {
+	argName string
+	body    milisp.Expression
+}
+
+func (f function) String() string {
+	body, err := milisp.Format(f.body)
+	if err != nil {
+		body = fmt.Sprint(f.body)
+	}
+	return fmt.Sprintf("function of %s: %s", f.argName, body)
+}
+
+func opDef(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+	if err := checkArgs(args, 3); err != nil {
+		return nil, err
+	}
+	name, err := milisp.SymbolName(args[0])
+	if err != nil {
+		return nil, err
+	}
+	argName, err := milisp.SymbolName(args[1])
+	if err != nil {
+		return nil, err
+	}
+	env.Set(name, function{argName: argName, body: args[2]})
+	return nil, nil
+}
+
+func opCall(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return nil, err
+	}
+	name, err := milisp.SymbolName(args[0])
+	if err != nil {
+		return nil, err
+	}
+	x, _ := env.Lookup(name)
+	f, ok := x.(function)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a function", name)
+	}
+	argValue, err := milisp.EvalContext(ctx, env, args[1])
+	if err != nil {
+		return nil, err
+	}
+	local := milisp.NewScope(env)
+	local.Set(f.argName, argValue)
+	return milisp.EvalContext(ctx, local, f.body) // ctx keeps the debugger
+}
+
+func arithmetic(op func(a, b float64) float64) milisp.ContextOpFunc {
+	return func(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+		if len(args) < 1 {
+			return nil, fmt.Errorf("too few args: %s", args)
+		}
+		x, err := milisp.EvalFloatContext(ctx, env, args[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range args[1:] {
+			y, err := milisp.EvalFloatContext(ctx, env, a)
+			if err != nil {
+				return nil, err
+			}
+			x = op(x, y)
+		}
+		return x, nil
+	}
+}
+
+func opPrint(out io.Writer) milisp.ContextOpFunc {
+	return func(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+		values := make([]interface{}, len(args))
+		for i, a := range args {
+			var err error
+			values[i], err = milisp.EvalContext(ctx, env, a)
+			if err != nil {
+				return nil, err
+			}
+		}
+		fmt.Fprintln(out, values...)
+		return nil, nil
+	}
+}
+
+func environment(out io.Writer) milisp.Environment {
+	return milisp.Environment{
+		"prog":      milisp.ContextOpFunc(opProg),
+		"set":       milisp.ContextOpFunc(opSet),
+		"loop":      milisp.ContextOpFunc(opLoop),
+		"if_gt_one": milisp.ContextOpFunc(opIfGtOne),
+		"def":       milisp.OpFunc(opDef),
+		"call":      milisp.ContextOpFunc(opCall),
+		"+":         arithmetic(func(a, b float64) float64 { return a + b }),
+		"-":         arithmetic(func(a, b float64) float64 { return a - b }),
+		"*":         arithmetic(func(a, b float64) float64 { return a * b }),
+		"/":         arithmetic(func(a, b float64) float64 { return a / b }),
+		"print":     opPrint(out),
+	}
+}
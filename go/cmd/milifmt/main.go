@@ -0,0 +1,128 @@
+// Milifmt formats MiLisp sources.
+//
+// Usage:
+//
+//	milifmt [flags] [path ...]
+//
+// Without paths, it formats standard input to standard output.
+// Flags:
+//
+//	-check   do not print formatted sources; list files whose formatting differs and exit with status 1
+//	-w       write result to (source) file instead of stdout, it requires paths
+//	-indent  indentation of nested lines (default two spaces)
+//	-width   maximum line width (default 80)
+//
+// Comments are kept, see milisp.Printer.FormatSource.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+func format(p milisp.Printer, src []byte) ([]byte, error) {
+	res, err := p.FormatSource(string(src))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(res), nil
+}
+
+func processFile(p milisp.Printer, name string, check, write bool, out io.Writer) (bool, error) {
+	src, err := os.ReadFile(name) //nolint:gosec // file name comes from user
+	if err != nil {
+		return false, err
+	}
+	res, err := format(p, src)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", name, err)
+	}
+	if bytes.Equal(src, res) {
+		return true, nil
+	}
+	switch {
+	case check:
+		fmt.Fprintln(out, name)
+	case write:
+		err = os.WriteFile(name, res, 0o644) //nolint:gosec // keep usual permissions for source file
+		if err != nil {
+			return false, err
+		}
+	default:
+		_, err = out.Write(res)
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func processInput(p milisp.Printer, check bool, in io.Reader, out io.Writer) (bool, error) {
+	src, err := io.ReadAll(in)
+	if err != nil {
+		return false, err
+	}
+	res, err := format(p, src)
+	if err != nil {
+		return false, err
+	}
+	ok := bytes.Equal(src, res)
+	if check {
+		if !ok {
+			fmt.Fprintln(out, "<standard input>")
+		}
+		return ok, nil
+	}
+	_, err = out.Write(res)
+	return ok, err
+}
+
+func run(args []string, in io.Reader, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("milifmt", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	check := flags.Bool("check", false, "list files whose formatting differs and exit with status 1")
+	write := flags.Bool("w", false, "write result to (source) file instead of stdout")
+	indent := flags.String("indent", "  ", "indentation of nested lines")
+	width := flags.Int("width", 80, "maximum line width")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	p := milisp.Printer{Indent: *indent, Width: *width}
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(errOut, "-w requires file paths, it can not write standard input")
+			return 2
+		}
+		ok, err := processInput(p, *check, in, out)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 2
+		}
+		if !ok && *check {
+			return 1
+		}
+		return 0
+	}
+	status := 0
+	for _, name := range flags.Args() {
+		ok, err := processFile(p, name, *check, *write, out)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			status = 2
+			continue
+		}
+		if !ok && *check && status == 0 {
+			status = 1
+		}
+	}
+	return status
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	unformatted = "(a   b\n (c))"
+	formatted   = "(a b (c))\n"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.lisp")
+	bad := filepath.Join(dir, "bad.lisp")
+	for name, text := range map[string]string{good: formatted, bad: unformatted} {
+		err := os.WriteFile(name, []byte(text), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []struct {
+		name  string
+		args  []string
+		input string
+		code  int
+		out   string
+	}{
+		{"stdin", nil, unformatted, 0, formatted},
+		{"stdin check ok", []string{"-check"}, formatted, 0, ""},
+		{"stdin check", []string{"-check"}, unformatted, 1, "<standard input>\n"},
+		{"files check ok", []string{"-check", good}, "", 0, ""},
+		{"files check", []string{"-check", good, bad}, "", 1, bad + "\n"},
+		{"files", []string{good, bad}, "", 0, formatted},
+		{"width", []string{"-width", "5", "-indent", "\t"}, unformatted, 0, "(a\n\tb\n\t(c))\n"},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			out := strings.Builder{}
+			errOut := strings.Builder{}
+			code := run(c.args, strings.NewReader(c.input), &out, &errOut)
+			if code != c.code || out.String() != c.out || errOut.Len() != 0 {
+				t.Errorf("Unexpected result: %d: %q: %q", code, out.String(), errOut.String())
+			}
+		})
+	}
+}
+
+func TestRun_write(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "x.lisp")
+	err := os.WriteFile(name, []byte(unformatted), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Builder{}
+	code := run([]string{"-w", name}, strings.NewReader(""), &out, &out)
+	if code != 0 || out.Len() != 0 {
+		t.Errorf("Unexpected exit: %d: %s", code, out.String())
+	}
+	res, err := os.ReadFile(name) //nolint:gosec // file is created by test
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != formatted {
+		t.Errorf("Unexpected file: %q", res)
+	}
+	code = run([]string{"-check", name}, strings.NewReader(""), &out, &out)
+	if code != 0 || out.Len() != 0 {
+		t.Errorf("File is not formatted: %d: %s", code, out.String())
+	}
+}
+
+func TestRun_errors(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		args  []string
+		input string
+		err   string
+	}{
+		{"bad flag", []string{"-x"}, "", "flag provided but not defined: -x\n"},
+		{"write stdin", []string{"-w"}, formatted, "-w requires file paths, it can not write standard input\n"},
+		{"syntax", nil, "(a", ""},
+		{"no file", []string{"no-such-file.lisp"}, "", "open no-such-file.lisp: no such file or directory\n"},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			out := strings.Builder{}
+			errOut := strings.Builder{}
+			code := run(c.args, strings.NewReader(c.input), &out, &errOut)
+			if code != 2 || out.Len() != 0 || !strings.HasPrefix(errOut.String(), c.err) {
+				t.Errorf("Unexpected result: %d: %q: %q", code, out.String(), errOut.String())
+			}
+		})
+	}
+}
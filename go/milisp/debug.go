@@ -0,0 +1,159 @@
+package milisp
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// DebugCommand tells debugger how to go on after pause.
+type DebugCommand int
+
+// Debugger commands.
+const (
+	DebugContinue DebugCommand = iota // run up to the next breakpoint
+	DebugStepInto                     // pause at the next expression
+	DebugStepOver                     // pause at the next expression that is not nested into the current one
+	DebugStepOut                      // pause at the next expression after the expression that encloses the current one
+	DebugStop                         // stop evaluation with *CanceledError
+)
+
+// Breakpoint pauses evaluation at the expression that matches all non-zero fields.
+// Breakpoint with Line, but without Column, pauses at expressions that start on the line,
+// however are not nested into expression on the same line. Breakpoint with Op pauses
+// at every list that starts with symbol Op.
+type Breakpoint struct {
+	Source string // name of source, see WithSourceName
+	Line   int
+	Column int
+	Op     string
+}
+
+func (b Breakpoint) String() string {
+	s := []string(nil)
+	if b.Source != "" || b.Line > 0 {
+		s = append(s, where(Position{Line: b.Line, Column: b.Column}, Span{Source: b.Source}))
+	}
+	if b.Op != "" {
+		s = append(s, "("+b.Op+" ...)")
+	}
+	return strings.Join(s, " ")
+}
+
+// Pause describes the expression that is going to be evaluated.
+type Pause struct {
+	Node       Node
+	Env        Environment // environment of expression, it is free to be modified
+	Depth      int         // nesting of expression, zero for root
+	Breakpoint *Breakpoint // breakpoint that has paused evaluation, nil if it is paused by step
+}
+
+// Names returns sorted names of all variables and operations in environment, including parent scopes.
+func (p *Pause) Names() []string {
+	res := p.Env.Names()
+	sort.Strings(res)
+	return res
+}
+
+// Debugger pauses evaluation at breakpoints and steps, see WithDebugger.
+// Lists, vectors, maps and symbols are paused at, constants are not.
+// Debugger is not safe for concurrent use, so it is for evaluations
+// that don't run operations in goroutines.
+type Debugger struct {
+	pause       func(*Pause) DebugCommand
+	breakpoints []Breakpoint
+	command     DebugCommand
+	target      int    // depth of the last pause
+	stack       []Node // expressions in progress
+}
+
+// NewDebugger creates debugger that pauses at the first expression.
+// Function pause is called synchronously at every pause, evaluation goes on according to returned command.
+func NewDebugger(pause func(*Pause) DebugCommand) *Debugger {
+	return &Debugger{pause: pause, command: DebugStepInto}
+}
+
+// WithDebugger attaches debugger to evaluation.
+func WithDebugger(d *Debugger) EvalOption {
+	return func(s *evalState) {
+		s.debugger = d
+	}
+}
+
+// AddBreakpoint adds breakpoint.
+func (d *Debugger) AddBreakpoint(b Breakpoint) {
+	d.breakpoints = append(d.breakpoints, b)
+}
+
+// RemoveBreakpoint removes all breakpoints equal to b.
+func (d *Debugger) RemoveBreakpoint(b Breakpoint) {
+	res := d.breakpoints[:0]
+	for _, x := range d.breakpoints {
+		if x != b {
+			res = append(res, x)
+		}
+	}
+	d.breakpoints = res
+}
+
+// Breakpoints returns all breakpoints.
+func (d *Debugger) Breakpoints() []Breakpoint {
+	return append([]Breakpoint(nil), d.breakpoints...)
+}
+
+func (d *Debugger) enter(n Node, env Environment) error {
+	depth := len(d.stack)
+	b := d.breakpoint(n)
+	var paused bool
+	switch d.command {
+	case DebugStepInto:
+		paused = true
+	case DebugStepOver:
+		paused = depth <= d.target
+	case DebugStepOut:
+		paused = depth < d.target
+	case DebugContinue, DebugStop:
+	}
+	if b == nil && !paused {
+		d.stack = append(d.stack, n)
+		return nil
+	}
+	d.command = d.pause(&Pause{Node: n, Env: env, Depth: depth, Breakpoint: b})
+	d.target = depth
+	if d.command == DebugStop {
+		return &CanceledError{Position: n.Position(), Span: n.Span(), Err: context.Canceled}
+	}
+	d.stack = append(d.stack, n)
+	return nil
+}
+
+func (d *Debugger) exit() {
+	d.stack = d.stack[:len(d.stack)-1]
+}
+
+// breakpoint returns the first breakpoint that matches node.
+func (d *Debugger) breakpoint(n Node) *Breakpoint {
+	pos, span := n.Position(), n.Span()
+	newLine := true
+	if len(d.stack) > 0 {
+		parent := d.stack[len(d.stack)-1]
+		newLine = parent.Position().Line != pos.Line || parent.Span().Source != span.Source
+	}
+	for _, b := range d.breakpoints {
+		if b.Source != "" && b.Source != span.Source ||
+			b.Line > 0 && b.Line != pos.Line ||
+			b.Line > 0 && b.Column == 0 && !newLine ||
+			b.Column > 0 && b.Column != pos.Column {
+			continue
+		}
+		if b.Op != "" {
+			list, ok := n.(*List)
+			if !ok || len(list.items) == 0 || operationName(list.items[0]) != b.Op {
+				continue
+			}
+		}
+		bp := b
+		return &bp
+	}
+	return nil
+}
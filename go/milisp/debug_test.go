@@ -0,0 +1,157 @@
+package milisp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+const loopText = `(prog
+  (set x 1)
+  (loop i 1 N
+    (set x (* x i)))
+  x)`
+
+func loopEnv() milisp.Environment {
+	return milisp.Environment{
+		"prog": milisp.ContextOpFunc(evalAllReturnLastResult),
+		"set":  milisp.ContextOpFunc(setVar),
+		"loop": milisp.ContextOpFunc(loop),
+		"*":    milisp.ContextOpFunc(mulAll),
+		"N":    3.,
+	}
+}
+
+// script returns pause function that records pauses and answers by commands.
+func script(log *[]string, commands ...milisp.DebugCommand) func(*milisp.Pause) milisp.DebugCommand {
+	return func(p *milisp.Pause) milisp.DebugCommand {
+		s, _ := milisp.Format(p.Node)
+		if p.Breakpoint != nil {
+			s += " by " + p.Breakpoint.String()
+		}
+		*log = append(*log, fmt.Sprintf("%d %s %s", p.Depth, p.Node.Position(), s))
+		if len(commands) == 0 {
+			return milisp.DebugContinue
+		}
+		c := commands[0]
+		commands = commands[1:]
+		return c
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	expr, err := milisp.Compile(loopText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name        string
+		breakpoints []milisp.Breakpoint
+		commands    []milisp.DebugCommand
+		pauses      []string
+	}{
+		{
+			name:     "step_into",
+			commands: []milisp.DebugCommand{milisp.DebugStepInto, milisp.DebugStepInto, milisp.DebugStepInto},
+			pauses: []string{
+				"0 1:1 (prog (set x 1) (loop i 1 N (set x (* x i))) x)",
+				"1 1:2 prog",
+				"1 2:3 (set x 1)",
+				"2 2:4 set",
+			},
+		},
+		{
+			name: "step_over",
+			commands: []milisp.DebugCommand{
+				milisp.DebugStepInto, milisp.DebugStepOver, milisp.DebugStepOver, milisp.DebugStepInto,
+				milisp.DebugStepOut, milisp.DebugStepOut,
+			},
+			pauses: []string{
+				"0 1:1 (prog (set x 1) (loop i 1 N (set x (* x i))) x)",
+				"1 1:2 prog",
+				"1 2:3 (set x 1)",
+				"1 3:3 (loop i 1 N (set x (* x i)))",
+				"2 3:4 loop",
+				"1 5:3 x",
+			},
+		},
+		{
+			name:        "op",
+			breakpoints: []milisp.Breakpoint{{Op: "*"}},
+			commands:    []milisp.DebugCommand{milisp.DebugContinue},
+			pauses: []string{
+				"0 1:1 (prog (set x 1) (loop i 1 N (set x (* x i))) x)",
+				"3 4:12 (* x i) by (* ...)",
+				"3 4:12 (* x i) by (* ...)",
+				"3 4:12 (* x i) by (* ...)",
+			},
+		},
+		{
+			name:        "line",
+			breakpoints: []milisp.Breakpoint{{Line: 4}, {Line: 5, Column: 3}},
+			commands:    []milisp.DebugCommand{milisp.DebugContinue},
+			pauses: []string{
+				"0 1:1 (prog (set x 1) (loop i 1 N (set x (* x i))) x)",
+				"2 4:5 (set x (* x i)) by 4:0",
+				"2 4:5 (set x (* x i)) by 4:0",
+				"2 4:5 (set x (* x i)) by 4:0",
+				"1 5:3 x by 5:3",
+			},
+		},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			pauses := []string(nil)
+			d := milisp.NewDebugger(script(&pauses, c.commands...))
+			for _, b := range c.breakpoints {
+				d.AddBreakpoint(b)
+			}
+			res, err := milisp.EvalContext(context.Background(), loopEnv(), expr, milisp.WithDebugger(d))
+			if err != nil || res != 6. {
+				t.Errorf("Unexpected result: %v, %v", res, err)
+			}
+			if strings.Join(pauses, "\n") != strings.Join(c.pauses, "\n") {
+				t.Errorf("Unexpected pauses:\n%s", strings.Join(pauses, "\n"))
+			}
+		})
+	}
+}
+
+func TestDebugger_modifyAndStop(t *testing.T) {
+	expr, err := milisp.Compile(loopText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := milisp.NewDebugger(func(p *milisp.Pause) milisp.DebugCommand {
+		if p.Depth == 0 {
+			p.Env["N"] = 5.
+			return milisp.DebugContinue
+		}
+		if p.Env["i"] == 4. {
+			return milisp.DebugStop
+		}
+		return milisp.DebugContinue
+	})
+	d.AddBreakpoint(milisp.Breakpoint{Op: "set"})
+	d.AddBreakpoint(milisp.Breakpoint{Line: 1})
+	d.RemoveBreakpoint(milisp.Breakpoint{Line: 1})
+	if len(d.Breakpoints()) != 1 {
+		t.Errorf("Unexpected breakpoints: %v", d.Breakpoints())
+	}
+	env := loopEnv()
+	_, err = milisp.EvalContext(context.Background(), milisp.NewScope(env), expr, milisp.WithDebugger(d))
+	var target *milisp.CanceledError
+	if !errors.As(err, &target) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if target.Position != (milisp.Position{Line: 4, Column: 5}) {
+		t.Errorf("Unexpected position: %s", target.Position)
+	}
+	if env["N"] != 3. {
+		t.Errorf("Environment of caller is modified")
+	}
+}
@@ -0,0 +1,261 @@
+package milisp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SyntaxError is returned by Compile if text can not be tokenized or parsed.
+// Position is zero if the error relates to the end of text.
+type SyntaxError struct {
+	msg      string
+	Position Position
+	Span     Span   // span of offending token or char
+	Token    string // offending token or char, if any
+	Err      error  // cause, if any: error of literal function, *ParseDepthError etc.
+}
+
+func (e *SyntaxError) Error() string {
+	return e.msg
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+func newSyntaxError(span Span, pos Position, token string, format string, a ...interface{}) *SyntaxError {
+	return &SyntaxError{
+		msg:      fmt.Sprintf(format, a...),
+		Position: pos,
+		Span:     span,
+		Token:    token,
+	}
+}
+
+// ParseDepthError is returned by Compile if nesting is too deep, see WithMaxParseDepth.
+type ParseDepthError struct {
+	Limit    int
+	Position Position // position of the first bracket that is too deep
+	Span     Span
+}
+
+func (e *ParseDepthError) Error() string {
+	return fmt.Sprintf("nesting depth exceeds %d at %s", e.Limit, where(e.Position, e.Span))
+}
+
+// UnknownSymbolError is returned if symbol is not found in environment.
+type UnknownSymbolError struct {
+	Name     string
+	Position Position
+	Span     Span
+}
+
+func (e *UnknownSymbolError) Error() string {
+	return fmt.Sprintf("runtime error: unknown symbol: SYM:%s@%s", e.Name, where(e.Position, e.Span))
+}
+
+// NotCallableError is returned if the first item of list is evaluated to something other than Operation.
+type NotCallableError struct {
+	Value    interface{} // result of evaluation of the first item
+	Expr     Expression  // the first item itself
+	Position Position    // position of list
+	Span     Span        // span of list
+}
+
+func (e *NotCallableError) Error() string {
+	return fmt.Sprintf("operation %T not executable: %s", e.Value, e.Expr)
+}
+
+// MapKeyError is returned if key of map is evaluated to something other than string.
+type MapKeyError struct {
+	Key      interface{} // result of evaluation of the key
+	Expr     Expression  // the key itself
+	Position Position    // position of map
+	Span     Span        // span of map
+}
+
+func (e *MapKeyError) Error() string {
+	return fmt.Sprintf("runtime error: map key %s is %T, not string, in map at %s",
+		e.Expr, e.Key, where(e.Position, e.Span))
+}
+
+// MapValueError is returned if map has key without value.
+// Parser never produces such maps, however, they can be built by NewMap or Apply.
+type MapValueError struct {
+	Expr     Expression // the key without value
+	Position Position   // position of map
+	Span     Span       // span of map
+}
+
+func (e *MapValueError) Error() string {
+	return fmt.Sprintf("runtime error: map key %s has no value in map at %s", e.Expr, where(e.Position, e.Span))
+}
+
+// OperationError wraps an error returned by Operation.Perform.
+// It is the error of operation itself, most likely caused by data
+// that operation got, not by the structure of expression.
+type OperationError struct {
+	Op       string // the first item of list, usually the name of operation
+	Position Position
+	Span     Span
+	Err      error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %s at %s: %s", e.Op, where(e.Position, e.Span), e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// CanceledError is returned by EvalContext if context is done. It wraps ctx.Err(),
+// so errors.Is(err, context.Canceled) and errors.Is(err, context.DeadlineExceeded) work.
+type CanceledError struct {
+	Position Position // position of list that has not been performed
+	Span     Span
+	Err      error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("evaluation canceled at %s: %s", where(e.Position, e.Span), e.Err)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// BudgetExceededError is returned by EvalContext if evaluation runs out of budget, see WithBudget.
+type BudgetExceededError struct {
+	Budget   int64
+	Used     int64    // steps requested including denied one, concurrent goroutines can request more
+	Position Position // position of expression that has not been evaluated
+	Span     Span
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("budget exceeded at %s: %d steps requested, %d allowed",
+		where(e.Position, e.Span), e.Used, e.Budget)
+}
+
+// EvalDepthError is returned by EvalContext if evaluation is nested too deep, see WithMaxDepth.
+type EvalDepthError struct {
+	Limit    int64
+	Position Position // position of expression that has not been evaluated
+	Span     Span
+}
+
+func (e *EvalDepthError) Error() string {
+	return fmt.Sprintf("evaluation depth exceeds %d at %s", e.Limit, where(e.Position, e.Span))
+}
+
+// Frame is an expression that has been evaluating when error occurred.
+type Frame struct {
+	Op       string // the first item of list, usually the name of operation
+	Position Position
+	Span     Span
+	Wrap     string // context that operation has added wrapping the nested error, if any
+}
+
+func (f Frame) String() string {
+	if f.Wrap != "" {
+		return fmt.Sprintf("%s at %s: %s", f.Op, where(f.Position, f.Span), f.Wrap)
+	}
+	return fmt.Sprintf("%s at %s", f.Op, where(f.Position, f.Span))
+}
+
+// EvalError carries the trace of all lists that enclose the failed expression.
+// Trace starts from the innermost list. The error renders like stack trace:
+//
+//	operation in at 3:11: bad data
+//	    in at 3:11
+//	    and at 3:6
+//	    vector at 2:2
+type EvalError struct {
+	Err   error
+	Trace []Frame
+	buf   *traceBuf
+}
+
+// traceBuf is the storage of traces that grow from the same error.
+// Traces have no spare capacity, so only withFrame writes beyond them.
+type traceBuf struct {
+	mu     sync.Mutex
+	frames []Frame // the longest trace
+}
+
+func (e *EvalError) Error() string {
+	b := strings.Builder{}
+	b.WriteString(e.Err.Error())
+	for _, f := range e.Trace {
+		b.WriteString("\n    ")
+		b.WriteString(f.String())
+	}
+	return b.String()
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// withFrame adds frame to the trace while error propagates up.
+// Error can be wrapped by operation, so we dig for trace; the context that operation has added
+// (like "in F" of fmt.Errorf("in F: %w", err)) goes to the frame. Errors can be cached and shared by operations, so the error is never modified: new error gets
+// new trace. New trace shares storage with the old one if the old one is the longest,
+// otherwise it is copied; so deep trace takes linear time.
+func withFrame(err error, e *List) error {
+	f := Frame{Op: operationName(e.items[0]), Position: e.pos, Span: e.span}
+	var ee *EvalError
+	if !errors.As(err, &ee) {
+		return &EvalError{Err: err, Trace: []Frame{f}, buf: &traceBuf{frames: []Frame{f}}}
+	}
+	if error(ee) != err {
+		f.Wrap = wrapping(err.Error(), ee.Error())
+	}
+	n := len(ee.Trace)
+	if b := ee.buf; b != nil && n > 0 {
+		b.mu.Lock()
+		if len(b.frames) == n && &b.frames[0] == &ee.Trace[0] {
+			b.frames = append(b.frames, f)
+			trace := b.frames[: n+1 : n+1]
+			b.mu.Unlock()
+			return &EvalError{Err: ee.Err, Trace: trace, buf: b}
+		}
+		b.mu.Unlock()
+	}
+	frames := make([]Frame, n, 2*n+1)
+	copy(frames, ee.Trace)
+	frames = append(frames, f)
+	return &EvalError{Err: ee.Err, Trace: frames[: n+1 : n+1], buf: &traceBuf{frames: frames}}
+}
+
+// wrapping returns what wrapper adds to the message of nested error.
+func wrapping(wrapper, nested string) string {
+	return strings.Trim(strings.Replace(wrapper, nested, "", 1), " :\n")
+}
+
+// isRuntimeError checks if err has been already classified by nested expression.
+func isRuntimeError(err error) bool {
+	var (
+		unknownSymbol *UnknownSymbolError
+		notCallable   *NotCallableError
+		mapKey        *MapKeyError
+		mapValue      *MapValueError
+		operation     *OperationError
+		canceled      *CanceledError
+		budget        *BudgetExceededError
+		depth         *EvalDepthError
+	)
+	return errors.As(err, &unknownSymbol) || errors.As(err, &notCallable) || errors.As(err, &mapKey) ||
+		errors.As(err, &mapValue) || errors.As(err, &operation) || errors.As(err, &canceled) ||
+		errors.As(err, &budget) || errors.As(err, &depth)
+}
+
+func operationName(e Expression) string {
+	if s, ok := e.(*Symbol); ok {
+		return s.name
+	}
+	return fmt.Sprint(e)
+}
@@ -0,0 +1,271 @@
+package milisp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+func TestSyntaxError(t *testing.T) {
+	for _, c := range []struct {
+		text  string
+		pos   milisp.Position
+		token string
+	}{
+		{"A B", milisp.Position{Line: 1, Column: 3}, "B"},
+		{"\n \\", milisp.Position{Line: 2, Column: 2}, "\\"},
+		{"", milisp.Position{}, ""},
+		{"(", milisp.Position{Line: 1, Column: 1}, "("},
+		{" (()", milisp.Position{Line: 1, Column: 2}, "("},
+	} {
+		c := c
+		t.Run(c.text, func(t *testing.T) {
+			_, err := milisp.Compile(c.text)
+			var target *milisp.SyntaxError
+			if !errors.As(err, &target) {
+				t.Fatalf("Unexpected error: %#v", err)
+			}
+			if target.Position != c.pos {
+				t.Errorf("Unexpected position: %s", target.Position)
+			}
+			if target.Token != c.token {
+				t.Errorf("Unexpected token: %q", target.Token)
+			}
+		})
+	}
+}
+
+func TestSyntaxError_unwrap(t *testing.T) {
+	errLiteral := errors.New("bad literal")
+	literal := milisp.WithLiteral("@", func(_ string) (interface{}, bool, error) {
+		return nil, false, errLiteral
+	})
+	_, err := milisp.Compile("(f @x)", literal)
+	if !errors.Is(err, errLiteral) {
+		t.Errorf("Unexpected error: %#v", err)
+	}
+	errs := milisp.Diagnose("(f @x)", literal)
+	if len(errs) != 1 || !errors.Is(errs[0], errLiteral) {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	_, err = milisp.Compile("99999999999999999999")
+	if !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("Unexpected error: %#v", err)
+	}
+	errs = milisp.Diagnose("((x))", milisp.WithMaxParseDepth(1))
+	var depthErr *milisp.ParseDepthError
+	if len(errs) != 1 || !errors.As(errs[0], &depthErr) || depthErr.Limit != 1 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	errData := errors.New("bad data")
+	env := milisp.Environment{
+		"F": milisp.OpFunc(func(_ milisp.Environment, _ []milisp.Expression) (interface{}, error) {
+			return nil, errData
+		}),
+		"P": milisp.OpFunc(func(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+			return args[0].Eval(env)
+		}),
+		"N": 1.,
+	}
+	t.Run("unknown", func(t *testing.T) {
+		_, err := milisp.EvalCode(env, "(P (P X))")
+		var target *milisp.UnknownSymbolError
+		if !errors.As(err, &target) {
+			t.Fatalf("Unexpected error: %#v", err)
+		}
+		if target.Name != "X" || target.Position != (milisp.Position{Line: 1, Column: 7}) {
+			t.Errorf("Unexpected error: %#v", target)
+		}
+		var opErr *milisp.OperationError
+		if errors.As(err, &opErr) {
+			t.Errorf("Unexpected error: %#v", opErr)
+		}
+	})
+	t.Run("not_callable", func(t *testing.T) {
+		_, err := milisp.EvalCode(env, "(P (N))")
+		var target *milisp.NotCallableError
+		if !errors.As(err, &target) {
+			t.Fatalf("Unexpected error: %#v", err)
+		}
+		if target.Value != 1. || target.Position != (milisp.Position{Line: 1, Column: 4}) {
+			t.Errorf("Unexpected error: %#v", target)
+		}
+	})
+	t.Run("map_key", func(t *testing.T) {
+		_, err := milisp.EvalCode(env, `(P {"a" 1 N 2})`)
+		var target *milisp.MapKeyError
+		if !errors.As(err, &target) {
+			t.Fatalf("Unexpected error: %#v", err)
+		}
+		if target.Key != 1. || target.Position != (milisp.Position{Line: 1, Column: 4}) {
+			t.Errorf("Unexpected error: %#v", target)
+		}
+		if target.Error() != "runtime error: map key SYM:N@1:11 is float64, not string, in map at 1:4" {
+			t.Errorf("Unexpected error: %s", target)
+		}
+		var opErr *milisp.OperationError
+		if errors.As(err, &opErr) {
+			t.Errorf("Unexpected error: %#v", opErr)
+		}
+	})
+	t.Run("operation", func(t *testing.T) {
+		_, err := milisp.EvalCode(env, "(P (F))")
+		var target *milisp.OperationError
+		if !errors.As(err, &target) {
+			t.Fatalf("Unexpected error: %#v", err)
+		}
+		if target.Op != "F" || target.Position != (milisp.Position{Line: 1, Column: 4}) {
+			t.Errorf("Unexpected error: %#v", target)
+		}
+		if !errors.Is(err, errData) {
+			t.Errorf("Unexpected error: %#v", err)
+		}
+		if target.Error() != "operation F at 1:4: bad data" {
+			t.Errorf("Unexpected error: %s", target)
+		}
+	})
+}
+
+func TestEvalError_trace(t *testing.T) {
+	env := milisp.Environment{
+		"P": milisp.OpFunc(func(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+			for _, a := range args {
+				_, err := a.Eval(env)
+				if err != nil {
+					return nil, fmt.Errorf("wrapped by operation: %w", err)
+				}
+			}
+			return nil, nil
+		}),
+	}
+	_, err := milisp.EvalCode(env, "(P\n  (P 1 (P X))\n  (P Y))")
+	var target *milisp.EvalError
+	if !errors.As(err, &target) {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	// context of every wrapping is kept: the innermost one is in the message, the others are in trace
+	expected := `wrapped by operation: runtime error: unknown symbol: SYM:X@2:11
+    P at 2:8
+    P at 2:3: wrapped by operation
+    P at 1:1: wrapped by operation`
+	if target.Error() != expected {
+		t.Errorf("Unexpected error:\n%s", target)
+	}
+}
+
+func TestEvalError_shared(t *testing.T) {
+	cached := error(nil) // operation returns the same error every time
+	env := milisp.Environment{
+		"P": milisp.OpFunc(func(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+			if cached == nil {
+				_, cached = args[0].Eval(env)
+			}
+			return nil, cached
+		}),
+	}
+	expr, err := milisp.Compile("(P (P X))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		_, err = expr.Eval(env)
+		var target *milisp.EvalError
+		if !errors.As(err, &target) {
+			t.Fatalf("Unexpected error: %#v", err)
+		}
+		if fmt.Sprint(target.Trace) != "[P at 1:4 P at 1:1]" {
+			t.Errorf("Unexpected trace: %v", target.Trace)
+		}
+	}
+	if fmt.Sprint(cached.(*milisp.EvalError).Trace) != "[P at 1:4]" {
+		t.Errorf("Cached error is modified: %v", cached)
+	}
+}
+
+func TestEvalError_deep(t *testing.T) {
+	env := milisp.Environment{
+		"P": milisp.ContextOpFunc(evalAllReturnLastResult),
+	}
+	text := strings.Repeat("(P ", 3e4) + "X" + strings.Repeat(")", 3e4)
+	expr, err := milisp.Compile(text, milisp.WithMaxParseDepth(6e4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithMaxDepth(0))
+	var target *milisp.EvalError
+	if !errors.As(err, &target) {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	if len(target.Trace) != 3e4 || cap(target.Trace) != len(target.Trace) {
+		t.Errorf("Unexpected trace: %d frames of %d", len(target.Trace), cap(target.Trace))
+	}
+}
+
+func TestErrors_sourceName(t *testing.T) {
+	_, err := milisp.Compile("(f\n\t(g \"\\q\"))", milisp.WithSourceName("a.lisp"))
+	var syntaxErr *milisp.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	if err.Error() != `tokenizer error: unknown escape sequence \q at a.lisp:2:13` {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if syntaxErr.Span.String() != "a.lisp:2:6-2:8" || syntaxErr.Span.Start.Offset != 8 {
+		t.Errorf("Unexpected span: %s", syntaxErr.Span)
+	}
+	// expressions from different sources are merged into one program
+	env := milisp.Environment{
+		"P": milisp.OpFunc(func(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+			return args[0].Eval(env)
+		}),
+	}
+	a, err := milisp.Compile("(P (P 1))", milisp.WithSourceName("a.lisp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := milisp.Compile("\n(P X)", milisp.WithSourceName("b.lisp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr := milisp.Apply(a, nil, func(c *milisp.Cursor) bool {
+		if _, ok := c.Node().(*milisp.Integer); ok {
+			c.Replace(b)
+		}
+		return true
+	})
+	_, err = expr.Eval(env)
+	expected := "runtime error: unknown symbol: SYM:X@b.lisp:2:4\n    P at b.lisp:2:1\n    P at a.lisp:1:4\n    P at a.lisp:1:1"
+	if err.Error() != expected {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func ExampleEvalError() {
+	env := milisp.Environment{
+		"vector": milisp.OpFunc(opVector),
+		"and":    milisp.OpFunc(opAnd),
+		"in":     milisp.OpFunc(opIn),
+		"A":      []string{"1"},
+		"x":      "1",
+		"y":      "2",
+		"z":      "3",
+	}
+	_, err := milisp.EvalCode(env, `
+	(vector
+	    (and (in x A) (in y A))
+	    (and (in x A) (in z B)))`)
+	fmt.Println(err)
+	// Output:
+	// runtime error: unknown symbol: SYM:B@4:33
+	//     in at 4:27
+	//     and at 4:13
+	//     vector at 2:9
+}
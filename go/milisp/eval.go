@@ -0,0 +1,296 @@
+package milisp
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// evalState carries everything that EvalContext attaches to evaluation.
+// It is shared by all nodes of evaluation, including nodes evaluated in goroutines.
+type evalState struct {
+	used     int64 // the first to be aligned for atomic operations
+	budget   int64
+	usage    *int64
+	maxDepth int64
+	tracer   Tracer
+	debugger *Debugger
+}
+
+// run is evaluation in progress. It is passed to nested nodes by value and never
+// gets to environment, so every chain of nested evaluations has its own depth.
+// Zero run is evaluation by Eval: no context, no budget, no tracing, depth is limited by DefaultMaxDepth.
+type run struct {
+	s     *evalState
+	ctx   context.Context
+	done  <-chan struct{} // ctx.Done(), it is obtained once
+	depth int64
+	frame interface{} // frame of enclosing node, see frameTracer
+}
+
+// runKey is the key of carrier in the context of ContextOperation.
+type runKey struct{}
+
+// carrier is the value of runKey: run and the context that carries it. Operation that passes
+// its ctx as is continues run with the context of run, so contexts don't nest deeper and deeper
+// on recursion.
+type carrier struct {
+	r   run
+	ctx context.Context
+}
+
+// frameTracer is Tracer that tells nested nodes from nodes that concurrent goroutines evaluate.
+// Evaluation calls enterFrame and exitFrame instead of Enter and Exit: enterFrame gets the frame
+// of enclosing node of the same chain, the frame that it returns goes to nested nodes and to exitFrame.
+type frameTracer interface {
+	enterFrame(n Node, parent interface{}) interface{}
+	exitFrame(n Node, frame interface{}, d time.Duration)
+}
+
+// evaluator is implemented by all nodes to evaluate them in run.
+type evaluator interface {
+	eval(r run, env Environment) (interface{}, error)
+}
+
+// evalIn evaluates expression in run. Expressions that are not nodes are evaluated by Eval,
+// so run doesn't reach them.
+func evalIn(r run, env Environment, e Expression) (interface{}, error) {
+	if n, ok := e.(evaluator); ok {
+		return n.eval(r, env)
+	}
+	return e.Eval(env)
+}
+
+// EvalOption tunes evaluation, see EvalContext.
+type EvalOption func(*evalState)
+
+// WithBudget limits the number of evaluation steps. Every evaluation of list, vector, map or symbol
+// is a step, every operation invocation is a step too, constants are free.
+// If budget runs out, evaluation stops with *BudgetExceededError.
+// Budget is shared by all goroutines that operations run. Zero or negative budget means no limit.
+//
+// Budget limits steps only. It doesn't limit memory and time that operations spend themselves:
+// operations have to check sizes of their data, and ctx with deadline limits time.
+func WithBudget(steps int64) EvalOption {
+	return func(s *evalState) {
+		s.budget = steps
+	}
+}
+
+// WithUsage makes EvalContext store the number of steps that evaluation has taken, see WithBudget.
+// Steps are counted with or without budget and are stored both on success and on error.
+func WithUsage(steps *int64) EvalOption {
+	return func(s *evalState) {
+		s.usage = steps
+	}
+}
+
+// DefaultMaxDepth limits nesting of evaluation by Eval and by EvalContext without WithMaxDepth.
+// Pay attention, operation that evaluates its arguments by arg.Eval(env) starts counting over,
+// so only ContextOperation that evaluates arguments by EvalContext is guarded against runaway recursion.
+const DefaultMaxDepth = 10000
+
+// WithMaxDepth limits nesting of evaluation: lists, vectors and maps that are evaluated
+// inside each other, including evaluation by operations like recursive function calls.
+// If evaluation goes deeper, it stops with *EvalDepthError instead of Go stack overflow.
+// Depth is counted along every chain of nested evaluations, so goroutines that operations run
+// don't add up. Zero or negative depth means no limit, default is DefaultMaxDepth.
+func WithMaxDepth(depth int64) EvalOption {
+	return func(s *evalState) {
+		s.maxDepth = depth
+	}
+}
+
+// ContextOperation is an Operation that takes the context of evaluation, see EvalContext.
+// PerformContext is called instead of Perform, ctx is context.Background() if expression
+// is evaluated by Eval. Besides the context of EvalContext, ctx carries evaluation itself:
+// arguments evaluated by EvalContext(ctx, env, arg) are canceled, limited, traced and debugged
+// like the rest of expression.
+type ContextOperation interface {
+	Operation
+	PerformContext(ctx context.Context, env Environment, args []Expression) (interface{}, error)
+}
+
+// ContextOpFunc is a helper type to use function as ContextOperation interface.
+type ContextOpFunc func(ctx context.Context, env Environment, args []Expression) (interface{}, error)
+
+// Perform operation function with background context.
+func (f ContextOpFunc) Perform(env Environment, args []Expression) (interface{}, error) {
+	return f(context.Background(), env, args)
+}
+
+// PerformContext performs operation function.
+func (f ContextOpFunc) PerformContext(ctx context.Context, env Environment, args []Expression) (interface{}, error) {
+	return f(ctx, env, args)
+}
+
+// spend takes one step from budget.
+func (s *evalState) spend(pos Position, span Span) error {
+	if used := atomic.AddInt64(&s.used, 1); s.budget > 0 && used > s.budget {
+		return &BudgetExceededError{Budget: s.budget, Used: used, Position: pos, Span: span}
+	}
+	return nil
+}
+
+// EvalContext evaluates expression like e.Eval(env) does, however it stops as soon as ctx is done.
+// Context is checked before evaluation of every list, vector, map and symbol, it is passed to every
+// ContextOperation. If ctx is done, evaluation returns *CanceledError that wraps ctx.Err().
+// Options let you limit and trace evaluation, see WithBudget, WithMaxDepth and WithTracer.
+// Environment is neither copied nor modified, everything is kept aside of it.
+//
+// Evaluation reaches operations through ctx only: ContextOperation gets ctx of evaluation
+// and continues evaluation by EvalContext(ctx, env, arg) without options (or with ctx derived from it).
+// Operation that evaluates its arguments by arg.Eval(env) is a boundary: its arguments are evaluated
+// like by Eval, out of context, limits, tracer and debugger.
+func EvalContext(ctx context.Context, env Environment, e Expression, opts ...EvalOption) (interface{}, error) {
+	c, ok := ctx.Value(runKey{}).(*carrier)
+	if ok && len(opts) == 0 {
+		r := c.r
+		if ctx != c.ctx { // derived context
+			r.ctx = ctx
+			r.done = ctx.Done()
+		}
+		return evalIn(r, env, e)
+	}
+	r := run{s: &evalState{maxDepth: DefaultMaxDepth}, ctx: ctx, done: ctx.Done()}
+	for _, o := range opts {
+		o(r.s)
+	}
+	if r.s.usage != nil {
+		defer func(s *evalState) { *s.usage = atomic.LoadInt64(&s.used) }(r.s)
+	}
+	return evalIn(r, env, e)
+}
+
+// context returns the context for ContextOperation: ctx of evaluation that carries run.
+// Run of Eval is carried by background context to keep the depth.
+func (r run) context() context.Context {
+	base := r.ctx
+	if base == nil {
+		base = context.Background()
+	}
+	c := &carrier{r: r}
+	c.ctx = context.WithValue(base, runKey{}, c)
+	return c.ctx
+}
+
+// maxDepth returns the limit of depth, zero or negative means no limit.
+func (r run) maxDepth() int64 {
+	if r.s == nil {
+		return DefaultMaxDepth
+	}
+	return r.s.maxDepth
+}
+
+// canceled checks the context without locks.
+func (r run) canceled(n Node) error {
+	if r.done == nil {
+		return nil
+	}
+	select {
+	case <-r.done:
+		return &CanceledError{Position: n.Position(), Span: n.Span(), Err: r.ctx.Err()}
+	default:
+		return nil
+	}
+}
+
+// visit is evaluation of node in progress.
+type visit struct {
+	s     *evalState
+	n     Node
+	frame interface{}
+	start time.Time
+}
+
+// enterPlain is enter of evaluation by Eval: there is nothing to spend, trace and debug, so there is no visit.
+// It checks the context (operation can pass one) and the depth.
+// Run is modified in place, it becomes run of nested nodes.
+func (r *run) enterPlain(n Node, deep bool) error {
+	if deep {
+		r.depth++
+		if r.depth > DefaultMaxDepth {
+			return &EvalDepthError{Limit: DefaultMaxDepth, Position: n.Position(), Span: n.Span()}
+		}
+	}
+	if r.done == nil {
+		return nil
+	}
+	return r.canceled(n)
+}
+
+// enter is called on entry of evaluation of list, vector, map (deep) or symbol by EvalContext, see enterPlain.
+// It checks the context, takes one step, notifies tracer and debugger.
+// It returns run of nested nodes: one level deeper if node is deep.
+// Visit have to exit if there is no error.
+func (r run) enter(n Node, env Environment, deep bool) (visit, run, error) {
+	if deep {
+		r.depth++
+	}
+	if err := r.canceled(n); err != nil {
+		return visit{}, r, err
+	}
+	s := r.s
+	if err := s.spend(n.Position(), n.Span()); err != nil {
+		return visit{}, r, err
+	}
+	if s.maxDepth > 0 && r.depth > s.maxDepth {
+		return visit{}, r, &EvalDepthError{Limit: s.maxDepth, Position: n.Position(), Span: n.Span()}
+	}
+	if s.debugger != nil {
+		if err := s.debugger.enter(n, env); err != nil {
+			return visit{}, r, err
+		}
+	}
+	v := visit{s: s, n: n}
+	if s.tracer != nil {
+		if ft, ok := s.tracer.(frameTracer); ok {
+			v.frame = ft.enterFrame(n, r.frame)
+			r.frame = v.frame
+		} else {
+			s.tracer.Enter(n)
+		}
+		v.start = time.Now()
+	}
+	return v, r, nil
+}
+
+// exit notifies tracer and debugger.
+func (v visit) exit(res interface{}, err error) {
+	if v.s.tracer != nil {
+		if ft, ok := v.s.tracer.(frameTracer); ok {
+			ft.exitFrame(v.n, v.frame, time.Since(v.start))
+		} else {
+			v.s.tracer.Exit(v.n, res, err, time.Since(v.start))
+		}
+	}
+	if v.s.debugger != nil {
+		v.s.debugger.exit()
+	}
+}
+
+// constant notifies tracer about evaluation of constant. Constants are free, they don't take steps.
+func (r run) constant(n Node, res interface{}, err error) (interface{}, error) {
+	if r.s != nil && r.s.tracer != nil {
+		if ft, ok := r.s.tracer.(frameTracer); ok {
+			ft.exitFrame(n, ft.enterFrame(n, r.frame), 0)
+		} else {
+			r.s.tracer.Enter(n)
+			r.s.tracer.Exit(n, res, err, 0)
+		}
+	}
+	return res, err
+}
+
+// perform calls operation, invocation takes one step.
+func (e *List) perform(r run, env Environment, operation Operation) (interface{}, error) {
+	if r.s != nil {
+		if err := r.s.spend(e.pos, e.span); err != nil {
+			return nil, err
+		}
+	}
+	if op, ok := operation.(ContextOperation); ok {
+		return op.PerformContext(r.context(), env, e.items[1:])
+	}
+	return operation.Perform(env, e.items[1:])
+}
@@ -0,0 +1,470 @@
+package milisp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+func TestEvalContext_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env := milisp.Environment{
+		"P": milisp.ContextOpFunc(evalAllReturnLastResult),
+		"C": milisp.OpFunc(func(_ milisp.Environment, _ []milisp.Expression) (interface{}, error) {
+			cancel()
+			return nil, nil
+		}),
+		"N": 1.,
+	}
+	expr, err := milisp.Compile("(P (C)\n  (P N))", milisp.WithSourceName("x.lisp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = milisp.EvalContext(ctx, env, expr)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	var target *milisp.CanceledError
+	if !errors.As(err, &target) {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	if target.Position != (milisp.Position{Line: 2, Column: 3}) {
+		t.Errorf("Unexpected position: %s", target.Position)
+	}
+	var opErr *milisp.OperationError
+	if errors.As(err, &opErr) {
+		t.Errorf("Cancellation is not an error of operation: %#v", opErr)
+	}
+	if err.Error() != "evaluation canceled at x.lisp:2:3: context canceled\n    P at x.lisp:2:3\n    P at x.lisp:1:1" {
+		t.Errorf("Unexpected message: %q", err.Error())
+	}
+	if len(env) != 3 {
+		t.Errorf("Environment is modified: %v", env)
+	}
+}
+
+func TestEvalContext_canceledInVector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env := milisp.Environment{
+		"C": milisp.OpFunc(func(_ milisp.Environment, _ []milisp.Expression) (interface{}, error) {
+			cancel()
+			return nil, nil
+		}),
+		"N": 1.,
+	}
+	expr, err := milisp.Compile("[(C) N]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = milisp.EvalContext(ctx, env, expr)
+	var target *milisp.CanceledError
+	if !errors.As(err, &target) {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	if target.Position != (milisp.Position{Line: 1, Column: 6}) { // symbol N
+		t.Errorf("Unexpected position: %s", target.Position)
+	}
+}
+
+func TestEvalContext_environment(t *testing.T) {
+	env := milisp.Environment{
+		"names": milisp.OpFunc(func(env milisp.Environment, _ []milisp.Expression) (interface{}, error) {
+			return len(env), nil
+		}),
+		"fresh": milisp.ContextOpFunc(func(ctx context.Context, _ milisp.Environment, args []milisp.Expression) (interface{}, error) {
+			return milisp.EvalContext(ctx, milisp.Environment{"P": milisp.ContextOpFunc(evalAllReturnLastResult)}, args[0])
+		}),
+	}
+	res, err := milisp.EvalContext(context.Background(), env, milisp.NewList([]milisp.Expression{
+		milisp.NewSymbol("names", milisp.Position{}),
+	}, milisp.Position{}), milisp.WithBudget(100))
+	if err != nil || res != 2 {
+		t.Errorf("Operation sees something besides environment: %v, %v", res, err)
+	}
+	if len(env) != 2 {
+		t.Errorf("Environment is modified: %v", env)
+	}
+	expr, err := milisp.Compile("(fresh (P (P (P (P)))))") // new environment keeps evaluation
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithMaxDepth(4))
+	var target *milisp.EvalDepthError
+	if !errors.As(err, &target) || target.Position != (milisp.Position{Line: 1, Column: 17}) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestEvalContext_derivedContext(t *testing.T) {
+	env := milisp.Environment{
+		"canceled": milisp.ContextOpFunc(func(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+			ctx, cancel := context.WithCancel(ctx)
+			cancel()
+			return milisp.EvalContext(ctx, env, args[0])
+		}),
+		"P": milisp.ContextOpFunc(evalAllReturnLastResult),
+	}
+	expr, err := milisp.Compile("(P (canceled (P 1)))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := int64(0)
+	_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithUsage(&used))
+	var target *milisp.CanceledError
+	if !errors.As(err, &target) || target.Position != (milisp.Position{Line: 1, Column: 14}) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if used != 6 { // the same evaluation goes on with derived context: (P, P, call, (canceled, canceled, call
+		t.Errorf("Unexpected usage: %d", used)
+	}
+}
+
+func TestEvalContext_deadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	lookup := func(ctx context.Context, _ milisp.Environment, _ []milisp.Expression) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Minute): // slow feature store
+			return "slow", nil
+		}
+	}
+	env := milisp.Environment{
+		"lookup": milisp.ContextOpFunc(lookup),
+	}
+	expr, err := milisp.Compile("(lookup)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = milisp.EvalContext(ctx, env, expr)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	var opErr *milisp.OperationError
+	if !errors.As(err, &opErr) || opErr.Op != "lookup" {
+		t.Errorf("Unexpected error: %#v", err)
+	}
+}
+
+type ctxKey struct{}
+
+func TestEvalContext_contextOperation(t *testing.T) {
+	op := func(ctx context.Context, _ milisp.Environment, _ []milisp.Expression) (interface{}, error) {
+		return ctx.Value(ctxKey{}), nil
+	}
+	env := milisp.Environment{
+		"P":     milisp.ContextOpFunc(evalAllReturnLastResult),
+		"value": milisp.ContextOpFunc(op),
+	}
+	expr, err := milisp.Compile("(P (value))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := milisp.EvalContext(context.WithValue(context.Background(), ctxKey{}, "ok"), env, expr)
+	if err != nil || res != "ok" {
+		t.Errorf("Unexpected result: %v, %v", res, err)
+	}
+	res, err = expr.Eval(env)
+	if err != nil || res != nil {
+		t.Errorf("Unexpected result without context: %v, %v", res, err)
+	}
+}
+
+func ExampleEvalContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // request has gone, for instance
+	env := milisp.Environment{
+		"+": milisp.ContextOpFunc(sumAll),
+	}
+	expr, err := milisp.Compile("(+ 1 2)")
+	if err != nil {
+		panic(err)
+	}
+	_, err = milisp.EvalContext(ctx, env, expr)
+	fmt.Println(err)
+	fmt.Println(errors.Is(err, context.Canceled))
+	// Output:
+	// evaluation canceled at 1:1: context canceled
+	//     + at 1:1
+	// true
+}
+
+func TestWithBudget(t *testing.T) {
+	env := milisp.Environment{
+		"P": milisp.ContextOpFunc(evalAllReturnLastResult),
+		"x": 1.,
+	}
+	expr, err := milisp.Compile("(P 1 x [x] {})") // list, P, invocation, x, vector, x, map
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := int64(0)
+	res, err := milisp.EvalContext(context.Background(), env, expr, milisp.WithBudget(7), milisp.WithUsage(&used))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if used != 7 {
+		t.Errorf("Unexpected usage: %d", used)
+	}
+	if len(res.(map[string]interface{})) != 0 {
+		t.Errorf("Unexpected result: %v", res)
+	}
+	var target *milisp.BudgetExceededError
+	for budget, pos := range map[int64]milisp.Position{
+		0: {Line: 1, Column: 1}, // list itself
+		1: {Line: 1, Column: 2}, // P
+		2: {Line: 1, Column: 1}, // invocation
+		3: {Line: 1, Column: 6}, // x
+		4: {Line: 1, Column: 8}, // [x]
+		5: {Line: 1, Column: 9}, // x in vector
+		6: {Line: 1, Column: 12},
+	} {
+		_, err := milisp.EvalContext(context.Background(), env, expr, milisp.WithBudget(budget), milisp.WithUsage(&used))
+		if budget == 0 {
+			if errors.As(err, &target) || used != 7 {
+				t.Errorf("Zero budget is unlimited: %v, %d", err, used)
+			}
+			continue
+		}
+		if !errors.As(err, &target) {
+			t.Errorf("Unexpected error for budget %d: %v", budget, err)
+			continue
+		}
+		if target.Budget != budget || target.Used != budget+1 || used != budget+1 || target.Position != pos {
+			t.Errorf("Unexpected error for budget %d: %#v", budget, target)
+		}
+	}
+}
+
+func TestWithBudget_recursion(t *testing.T) {
+	env := milisp.Environment{
+		"prog": milisp.ContextOpFunc(evalAllReturnLastResult),
+		"def":  milisp.OpFunc(functionDefinition),
+		"call": milisp.ContextOpFunc(functionCall), // evaluates function in new scope, budget is kept by ctx
+		"+":    milisp.ContextOpFunc(sumAll),
+	}
+	expr, err := milisp.Compile("(prog (def F x (call F (+ x 1))) (call F 0))") // infinite recursion
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = milisp.EvalContext(context.Background(), milisp.NewScope(env), expr, milisp.WithBudget(1000))
+	var target *milisp.BudgetExceededError
+	if !errors.As(err, &target) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := env["F"]; ok {
+		t.Errorf("Environment is modified")
+	}
+}
+
+func ExampleWithBudget() {
+	text := `
+	(prog
+	    (set x 1)
+	    (loop i 1 N
+	        (set x (* x i)))
+	    x)`
+	env := milisp.Environment{
+		"prog": milisp.ContextOpFunc(evalAllReturnLastResult),
+		"set":  milisp.ContextOpFunc(setVar),
+		"loop": milisp.ContextOpFunc(loop),
+		"*":    milisp.ContextOpFunc(mulAll),
+		"N":    1e12, // too long
+	}
+	expr, err := milisp.Compile(text)
+	if err != nil {
+		panic(err)
+	}
+	_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithBudget(1000))
+	var budgetErr *milisp.BudgetExceededError
+	fmt.Println(errors.As(err, &budgetErr), budgetErr.Used)
+	fmt.Println(err)
+	// Output:
+	// true 1001
+	// budget exceeded at 5:27: 1001 steps requested, 1000 allowed
+	//     * at 5:24
+	//     set at 5:17
+	//     loop at 4:13
+	//     prog at 2:9
+}
+
+func TestWithMaxDepth(t *testing.T) {
+	env := milisp.Environment{
+		"P": milisp.ContextOpFunc(evalAllReturnLastResult),
+	}
+	for _, c := range []struct {
+		text string
+		pos  milisp.Position
+	}{
+		{"(P (P [{}]))", milisp.Position{}},
+		{"(P (P [{} [1]] (P (P (P)))))", milisp.Position{Line: 1, Column: 22}},
+		{"(P (P [{} [1] [[]]]))", milisp.Position{Line: 1, Column: 16}},
+		{"(P (P {\"k\" (P (P))}))", milisp.Position{Line: 1, Column: 15}},
+	} {
+		c := c
+		t.Run(c.text, func(t *testing.T) {
+			expr, err := milisp.Compile(c.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithMaxDepth(4))
+			if c.pos == (milisp.Position{}) {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			var target *milisp.EvalDepthError
+			if !errors.As(err, &target) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if target.Limit != 4 || target.Position != c.pos {
+				t.Errorf("Unexpected error: %#v", target)
+			}
+		})
+	}
+}
+
+func TestWithMaxDepth_recursion(t *testing.T) {
+	env := milisp.Environment{
+		"prog": milisp.ContextOpFunc(evalAllReturnLastResult),
+		"def":  milisp.OpFunc(functionDefinition),
+		"call": milisp.ContextOpFunc(functionCall),
+		"+":    milisp.ContextOpFunc(sumAll),
+	}
+	expr, err := milisp.Compile("(prog (def F x (call F (+ x 1))) (call F 0))") // infinite recursion
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithMaxDepth(100))
+	var target *milisp.EvalDepthError
+	if !errors.As(err, &target) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if target.Limit != 100 {
+		t.Errorf("Unexpected error: %#v", target)
+	}
+}
+
+// opPar evaluates arguments concurrently, every argument in its own goroutine.
+func opPar(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+	errs := make([]error, len(args))
+	wg := sync.WaitGroup{}
+	for i, a := range args {
+		wg.Add(1)
+		go func(i int, a milisp.Expression) {
+			defer wg.Done()
+			_, errs[i] = milisp.EvalContext(ctx, env, a)
+		}(i, a)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func TestWithMaxDepth_goroutines(t *testing.T) {
+	env := milisp.Environment{
+		"par": milisp.ContextOpFunc(opPar),
+		"P":   milisp.ContextOpFunc(evalAllReturnLastResult),
+	}
+	expr, err := milisp.Compile("(par (P (P)) (P (P)) (P (P)) (P (P)))") // depth is 3 in every goroutine
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithMaxDepth(3))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
+
+func TestEval_defaultMaxDepth(t *testing.T) {
+	expr, err := milisp.Compile("(R)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := milisp.Environment{
+		"R": milisp.ContextOpFunc(func(ctx context.Context, env milisp.Environment, _ []milisp.Expression) (interface{}, error) {
+			return milisp.EvalContext(ctx, env, expr) // infinite recursion
+		}),
+	}
+	for _, eval := range []func() (interface{}, error){
+		func() (interface{}, error) { return expr.Eval(env) },
+		func() (interface{}, error) { return milisp.EvalContext(context.Background(), env, expr) },
+	} {
+		_, err = eval()
+		var target *milisp.EvalDepthError
+		if !errors.As(err, &target) || target.Limit != milisp.DefaultMaxDepth {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+}
+
+func TestEval_deepQuote(t *testing.T) {
+	const n = 100000
+	expr, err := milisp.Compile("'" + strings.Repeat("(", n) + strings.Repeat(")", n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = expr.Eval(nil)
+	var target *milisp.EvalDepthError
+	if !errors.As(err, &target) || target.Limit != milisp.DefaultMaxDepth {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	expr, err = milisp.Compile("['[[x]]]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := milisp.EvalContext(context.Background(), nil, expr, milisp.WithMaxDepth(3))
+	if err != nil || fmt.Sprint(res) != "[[[SYM:x@1:5]]]" {
+		t.Errorf("Unexpected result: %v, %v", res, err)
+	}
+	_, err = milisp.EvalContext(context.Background(), nil, expr, milisp.WithMaxDepth(2))
+	if !errors.As(err, &target) || target.Position.Column != 4 {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// BenchmarkEval measures Eval without options: it has to stay as cheap as plain recursion.
+func BenchmarkEval(b *testing.B) {
+	env := milisp.Environment{
+		"+": milisp.OpFunc(func(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+			s := 0.
+			for _, a := range args {
+				v, err := milisp.EvalFloat(env, a)
+				if err != nil {
+					return nil, err
+				}
+				s += v
+			}
+			return s, nil
+		}),
+		"x": 1.,
+		"y": 2.,
+	}
+	expr, err := milisp.Compile("(+ x y (+ x y (+ x y) (+ x y)) (+ x (+ y x)))")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err = expr.Eval(env)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -25,7 +25,7 @@ func Example_allExpressionTypes() {
 		if err != nil {
 			return nil, err
 		}
-		op, ok := env[opName]
+		op, ok := env.Lookup(opName)
 		if !ok {
 			return nil, fmt.Errorf("operation with name %s not exists in env", opName)
 		}
@@ -1,16 +1,17 @@
 package milisp_test
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/michurin/milisp/go/milisp"
 )
 
-func evalAllReturnLastResult(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+func evalAllReturnLastResult(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
 	res := interface{}(nil)
 	for _, a := range args { // check len in real life
 		var err error
-		res, err = a.Eval(env)
+		res, err = milisp.EvalContext(ctx, env, a)
 		if err != nil {
 			return nil, err
 		}
@@ -18,13 +19,13 @@ func evalAllReturnLastResult(env milisp.Environment, args []milisp.Expression) (
 	return res, nil
 }
 
-func mulAll(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+func mulAll(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
 	if len(args) < 1 {
 		return nil, fmt.Errorf("too few args: %s", args)
 	}
 	x := float64(1)
 	for _, a := range args {
-		res, err := milisp.EvalFloat(env, a)
+		res, err := milisp.EvalFloatContext(ctx, env, a)
 		if err != nil {
 			return nil, err
 		}
@@ -33,10 +34,10 @@ func mulAll(env milisp.Environment, args []milisp.Expression) (interface{}, erro
 	return x, nil
 }
 
-func sumAll(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+func sumAll(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
 	x := float64(0)
 	for _, a := range args {
-		res, err := milisp.EvalFloat(env, a)
+		res, err := milisp.EvalFloatContext(ctx, env, a)
 		if err != nil {
 			return nil, err
 		}
@@ -45,36 +46,36 @@ func sumAll(env milisp.Environment, args []milisp.Expression) (interface{}, erro
 	return x, nil
 }
 
-func setVar(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
-	varName, err := milisp.EvalString(env, args[0])
+func setVar(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+	varName, err := milisp.SymbolName(args[0])
 	if err != nil {
 		return nil, err
 	}
-	varValue, err := args[1].Eval(env)
+	varValue, err := milisp.EvalContext(ctx, env, args[1])
 	if err != nil {
 		return nil, err
 	}
-	env[varName] = varValue
+	env.Set(varName, varValue)
 	return nil, nil
 }
 
-func loop(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
-	varName, err := milisp.EvalString(env, args[0])
+func loop(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+	varName, err := milisp.SymbolName(args[0])
 	if err != nil {
 		return nil, err
 	}
-	first, err := milisp.EvalFloat(env, args[1])
+	first, err := milisp.EvalFloatContext(ctx, env, args[1])
 	if err != nil {
 		return nil, err
 	}
-	last, err := milisp.EvalFloat(env, args[2])
+	last, err := milisp.EvalFloatContext(ctx, env, args[2])
 	if err != nil {
 		return nil, err
 	}
 	body := args[3]
 	for i := int(first); i <= int(last); i++ {
-		env[varName] = float64(i)
-		_, err = body.Eval(env)
+		env.Set(varName, float64(i))
+		_, err = milisp.EvalContext(ctx, env, body)
 		if err != nil {
 			return nil, err
 		}
@@ -82,16 +83,16 @@ func loop(env milisp.Environment, args []milisp.Expression) (interface{}, error)
 	return nil, nil
 }
 
-func ifGtOne(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
-	value, err := milisp.EvalFloat(env, args[0])
+func ifGtOne(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+	value, err := milisp.EvalFloatContext(ctx, env, args[0])
 	if err != nil {
 		return nil, err
 	}
 	var res interface{}
 	if value > 1. { // example of laziness, we don't evaluate unnecessary argument
-		res, err = args[1].Eval(env)
+		res, err = milisp.EvalContext(ctx, env, args[1])
 	} else {
-		res, err = args[2].Eval(env)
+		res, err = milisp.EvalContext(ctx, env, args[2])
 	}
 	if err != nil {
 		return nil, err
@@ -105,37 +106,36 @@ type function struct {
 }
 
 func functionDefinition(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
-	funcName, err := milisp.EvalString(env, args[0])
+	funcName, err := milisp.SymbolName(args[0])
 	if err != nil {
 		return nil, err
 	}
-	argName, err := milisp.EvalString(env, args[1])
+	argName, err := milisp.SymbolName(args[1])
 	if err != nil {
 		return nil, err
 	}
-	env[funcName] = function{
+	env.Set(funcName, function{
 		argName: argName,
 		body:    args[2],
-	}
+	})
 	return nil, nil
 }
 
-func functionCall(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
-	funcName, err := milisp.EvalString(env, args[0])
+func functionCall(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+	funcName, err := milisp.SymbolName(args[0])
 	if err != nil {
 		return nil, err
 	}
-	argValue, err := args[1].Eval(env)
+	argValue, err := milisp.EvalContext(ctx, env, args[1])
 	if err != nil {
 		return nil, err
 	}
-	f := env[funcName].(function) //nolint:forcetypeassert // do not forget to check here
-	localEnv := milisp.Environment{}
-	for k, v := range env {
-		localEnv[k] = v
-	}
-	localEnv[f.argName] = argValue
-	res, err := f.body.Eval(localEnv)
+	x, _ := env.Lookup(funcName)
+	f := x.(function) //nolint:forcetypeassert // do not forget to check here
+
+	localEnv := milisp.NewScope(env) // it is cheaper than copying of env
+	localEnv.Set(f.argName, argValue)
+	res, err := milisp.EvalContext(ctx, localEnv, f.body)
 	if err != nil {
 		return nil, err
 	}
@@ -145,18 +145,18 @@ func functionCall(env milisp.Environment, args []milisp.Expression) (interface{}
 func Example_factorialLoop() {
 	text := `
 	(prog                     # execute all following expressions and return result of last
-	    (set "x" 1)           # x = 1
-	    (loop "i" 1 N         # for i = 1; i <= N; i++
-	        (set "x" (* x i)) # x = x * i
+	    (set x 1)             # x = 1
+	    (loop i 1 N           # for i = 1; i <= N; i++
+	        (set x (* x i))   # x = x * i
 	    )
 	    x                     # return x
 	)`
 	env := milisp.Environment{
 		// take a look inside examples file for implementations
-		"prog": milisp.OpFunc(evalAllReturnLastResult),
-		"set":  milisp.OpFunc(setVar), // it shows how to create new variables in env
-		"loop": milisp.OpFunc(loop),   // it shows how to mutate variables
-		"*":    milisp.OpFunc(mulAll),
+		"prog": milisp.ContextOpFunc(evalAllReturnLastResult),
+		"set":  milisp.ContextOpFunc(setVar), // it shows how to create new variables in env and how to use bare symbols
+		"loop": milisp.ContextOpFunc(loop),   // it shows how to mutate variables
+		"*":    milisp.ContextOpFunc(mulAll),
 		"N":    5.,
 	}
 	res, err := milisp.EvalCode(env, text)
@@ -170,22 +170,22 @@ func Example_factorialLoop() {
 func Example_factorialRecursive() {
 	text := `
 	(prog
-	    (def "F" "x" (if_gt_one   # if x > 1 then F(x-1) else 1
+	    (def F x (if_gt_one       # if x > 1 then F(x-1) else 1
 	        x
-	        (* x (call "F" (+ x -1)))
+	        (* x (call F (+ x -1)))
 	        1
 	    ))
-	    (call "F" N)
+	    (call F N)
 	)`
 	env := milisp.Environment{
 		// take a look inside examples file for implementations
-		"prog":      milisp.OpFunc(evalAllReturnLastResult),
-		"set":       milisp.OpFunc(setVar),
+		"prog":      milisp.ContextOpFunc(evalAllReturnLastResult),
+		"set":       milisp.ContextOpFunc(setVar),
 		"def":       milisp.OpFunc(functionDefinition),
-		"call":      milisp.OpFunc(functionCall), // local scopes (local copies of env)
-		"if_gt_one": milisp.OpFunc(ifGtOne),      // lazy and conditional execution
-		"*":         milisp.OpFunc(mulAll),
-		"+":         milisp.OpFunc(sumAll),
+		"call":      milisp.ContextOpFunc(functionCall), // local scopes (chained to env)
+		"if_gt_one": milisp.ContextOpFunc(ifGtOne),      // lazy and conditional execution
+		"*":         milisp.ContextOpFunc(mulAll),
+		"+":         milisp.ContextOpFunc(sumAll),
 		"N":         5.,
 	}
 	res, err := milisp.EvalCode(env, text)
@@ -2,6 +2,7 @@ package milisp_test
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/michurin/milisp/go/milisp"
 )
@@ -40,11 +41,21 @@ func opIn(env milisp.Environment, args []milisp.Expression) (interface{}, error)
 	if err != nil {
 		return nil, err
 	}
-	list := rawList.([]string) //nolint:forcetypeassert // do not forget to check here
-	for _, v := range list {
-		if v == val {
-			return true, nil
+	switch list := rawList.(type) {
+	case []string: // constant from environment
+		for _, v := range list {
+			if v == val {
+				return true, nil
+			}
 		}
+	case []interface{}: // quoted list: '("095" "495")
+		for _, v := range list {
+			if v == val {
+				return true, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("list expected, got %T", rawList)
 	}
 	return false, nil
 }
@@ -61,7 +72,7 @@ func opSetStringList(env milisp.Environment, args []milisp.Expression) (interfac
 			return nil, err
 		}
 	}
-	env[varName] = list
+	env.Set(varName, list)
 	return nil, nil
 }
 
@@ -128,7 +139,7 @@ func Example_oneHotFeaturesWithConstantsAsModelAttr() {
 		"vector":       milisp.OpFunc(opVector),
 		"and":          milisp.OpFunc(opAnd),
 		"in":           milisp.OpFunc(opIn),
-		"prog":         milisp.OpFunc(evalAllReturnLastResult),
+		"prog":         milisp.ContextOpFunc(evalAllReturnLastResult),
 		"set_str_list": milisp.OpFunc(opSetStringList),
 		// data
 		"phoneCountryCode": "+44",
@@ -145,3 +156,67 @@ func Example_oneHotFeaturesWithConstantsAsModelAttr() {
 	fmt.Println(res)
 	// Output: [1 0 0]
 }
+
+// Quoted lists let you keep categories right in the expression.
+func Example_oneHotFeaturesWithInlineConstants() {
+	text := `
+	(vector
+	    (and (in phoneCountryCode '("+44")) (in phoneAreaCode '("020")))
+	    (and (in phoneCountryCode '("+972")) (in phoneAreaCode '("3")))
+	    (and (in phoneCountryCode '("+7")) (in phoneAreaCode '("095" "495")))
+    )`
+	env := milisp.Environment{
+		// functions
+		"vector": milisp.OpFunc(opVector),
+		"and":    milisp.OpFunc(opAnd),
+		"in":     milisp.OpFunc(opIn),
+		// data
+		"phoneCountryCode": "+7",
+		"phoneAreaCode":    "495",
+	}
+	res, err := milisp.EvalCode(env, text)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(res)
+	// Output: [0 0 1]
+}
+
+// Constants that are initialized once can be shared by concurrent evaluations.
+// Base is never modified, every evaluation gets its own cheap overlay for inputs.
+func Example_oneHotFeaturesWithFrozenConstants() {
+	env := milisp.Environment{
+		"vector":       milisp.OpFunc(opVector),
+		"and":          milisp.OpFunc(opAnd),
+		"in":           milisp.OpFunc(opIn),
+		"prog":         milisp.ContextOpFunc(evalAllReturnLastResult),
+		"set_str_list": milisp.OpFunc(opSetStringList),
+	}
+	_, err := milisp.EvalCode(env, `(prog (set_str_list "UK" "+44") (set_str_list "IL" "+972"))`)
+	if err != nil {
+		panic(err)
+	}
+	base := milisp.Freeze(env)
+	expr, err := milisp.Compile(`(vector (in phoneCountryCode UK) (in phoneCountryCode IL))`)
+	if err != nil {
+		panic(err)
+	}
+	results := make([]interface{}, 2)
+	wg := sync.WaitGroup{}
+	for i, code := range []string{"+44", "+972"} {
+		wg.Add(1)
+		go func(i int, code string) {
+			defer wg.Done()
+			local := base.Overlay()
+			local.Set("phoneCountryCode", code)
+			res, err := expr.Eval(local)
+			if err != nil {
+				panic(err)
+			}
+			results[i] = res
+		}(i, code)
+	}
+	wg.Wait()
+	fmt.Println(results)
+	// Output: [[1 0] [0 1]]
+}
@@ -1,32 +1,334 @@
 package milisp
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+)
 
-type expr struct {
-	expr []Expression
-	line int
-	pos  int
+// List is a parenthesized expression. The first item refers to operation, the rest are its arguments.
+type List struct {
+	items []Expression
+	pos   Position
+	span  Span
 }
 
-func (e expr) String() string {
-	return fmt.Sprintf("%s@%d:%d", e.expr, e.line, e.pos)
+// NewList creates list node.
+func NewList(items []Expression, pos Position) *List {
+	return &List{items: items, pos: pos}
 }
 
-func (e expr) Eval(env Environment) (interface{}, error) {
-	if len(e.expr) == 0 {
-		return nil, nil
+// Items returns all subexpressions including operation.
+func (e *List) Items() []Expression {
+	return e.items
+}
+
+// Position of opening bracket in the source.
+func (e *List) Position() Position {
+	return e.pos
+}
+
+// Span of list in the source, including brackets.
+func (e *List) Span() Span {
+	return e.span
+}
+
+func (e *List) String() string {
+	return fmt.Sprintf("%s@%s", e.items, e.pos)
+}
+
+// Eval evaluates the first item to obtain operation and performs it with the rest items as arguments.
+func (e *List) Eval(env Environment) (interface{}, error) {
+	return e.eval(run{}, env)
+}
+
+func (e *List) eval(r run, env Environment) (res interface{}, err error) {
+	if len(e.items) == 0 {
+		return r.constant(e, nil, nil)
+	}
+	if r.s == nil { // fast path of Eval
+		if err := r.enterPlain(e, true); err != nil {
+			return nil, withFrame(err, e)
+		}
+		return e.call(r, env)
 	}
-	op, err := e.expr[0].Eval(env)
+	v, r, err := r.enter(e, env, true)
 	if err != nil {
-		return nil, err
+		return nil, withFrame(err, e)
+	}
+	defer func() { v.exit(res, err) }()
+	return e.call(r, env)
+}
+
+// call evaluates operation and performs it.
+func (e *List) call(r run, env Environment) (interface{}, error) {
+	op, err := evalIn(r, env, e.items[0])
+	if err != nil {
+		return nil, withFrame(err, e)
 	}
 	operation, ok := op.(Operation)
 	if !ok {
-		return nil, fmt.Errorf("operation %T not executable: %s", op, e.expr[0])
+		return nil, withFrame(&NotCallableError{Value: op, Expr: e.items[0], Position: e.pos, Span: e.span}, e)
+	}
+	res, err := e.perform(r, env, operation)
+	if err != nil {
+		if !isRuntimeError(err) {
+			err = &OperationError{Op: operationName(e.items[0]), Position: e.pos, Span: e.span, Err: err}
+		}
+		return nil, withFrame(err, e)
+	}
+	return res, nil
+}
+
+// Quote is a quoted expression: 'x or (quote x). Quoted expression is data, not code:
+// it is not evaluated, Walk and Apply don't traverse it.
+type Quote struct {
+	datum Expression
+	pos   Position
+	span  Span
+}
+
+// NewQuote creates quote node.
+func NewQuote(datum Expression, pos Position) *Quote {
+	return &Quote{datum: datum, pos: pos}
+}
+
+// Datum returns quoted expression.
+func (e *Quote) Datum() Expression {
+	return e.datum
+}
+
+// Position of apostrophe or opening bracket in the source.
+func (e *Quote) Position() Position {
+	return e.pos
+}
+
+// Span of quote in the source, including apostrophe or brackets.
+func (e *Quote) Span() Span {
+	return e.span
+}
+
+func (e *Quote) String() string {
+	return fmt.Sprintf("QUOTE:%s@%s", e.datum, e.pos)
+}
+
+// Eval returns quoted expression as data: lists turn into []interface{},
+// vectors and maps turn into slices and maps like they do being evaluated,
+// constants turn into their values, symbols and nested quotes are kept as is (*Symbol and *Quote).
+func (e *Quote) Eval(env Environment) (interface{}, error) {
+	return e.eval(run{}, env)
+}
+
+func (e *Quote) eval(r run, _ Environment) (interface{}, error) {
+	res, err := datumValue(r.depth, r.maxDepth(), e.datum)
+	return r.constant(e, res, err)
+}
+
+// datumValue converts quoted data to value. Nested lists, vectors and maps are counted
+// like in evaluation, so deep data stops with *EvalDepthError instead of Go stack overflow.
+func datumValue(depth, limit int64, e Expression) (interface{}, error) {
+	if node, _ := children(e); node != nil {
+		depth++
+		if limit > 0 && depth > limit {
+			return nil, &EvalDepthError{Limit: limit, Position: node.Position(), Span: node.Span()}
+		}
+	}
+	switch n := e.(type) {
+	case *List:
+		return datumValues(depth, limit, n.items)
+	case *Vector:
+		res, err := datumValues(depth, limit, n.items)
+		if err != nil {
+			return nil, err
+		}
+		return typedSlice(res), nil
+	case *Map:
+		values, err := datumValues(depth, limit, n.items)
+		if err != nil {
+			return nil, err
+		}
+		if len(values)%2 != 0 {
+			return nil, &MapValueError{Expr: n.items[len(n.items)-1], Position: n.pos, Span: n.span}
+		}
+		res := make(map[string]interface{}, len(values)/2)
+		for i := 0; i < len(values); i += 2 {
+			key, ok := values[i].(string)
+			if !ok {
+				return nil, &MapKeyError{Key: values[i], Expr: n.items[i], Position: n.pos, Span: n.span}
+			}
+			res[key] = values[i+1]
+		}
+		return res, nil
+	case *Symbol, *Quote:
+		return n, nil
+	default: // constants
+		return n.Eval(nil)
+	}
+}
+
+func datumValues(depth, limit int64, items []Expression) ([]interface{}, error) {
+	res := make([]interface{}, len(items))
+	for i, x := range items {
+		var err error
+		res[i], err = datumValue(depth, limit, x)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Vector is a bracketed sequence of expressions: [1 2 x].
+type Vector struct {
+	items []Expression
+	pos   Position
+	span  Span
+}
+
+// NewVector creates vector node.
+func NewVector(items []Expression, pos Position) *Vector {
+	return &Vector{items: items, pos: pos}
+}
+
+// Items returns all subexpressions.
+func (e *Vector) Items() []Expression {
+	return e.items
+}
+
+// Position of opening bracket in the source.
+func (e *Vector) Position() Position {
+	return e.pos
+}
+
+// Span of vector in the source, including brackets.
+func (e *Vector) Span() Span {
+	return e.span
+}
+
+func (e *Vector) String() string {
+	return fmt.Sprintf("VEC:%s@%s", e.items, e.pos)
+}
+
+// Eval evaluates all items. It returns typed slice like []float64, []int64 or []string
+// if all results have the same type, and []interface{} otherwise.
+func (e *Vector) Eval(env Environment) (interface{}, error) {
+	return e.eval(run{}, env)
+}
+
+func (e *Vector) eval(r run, env Environment) (res interface{}, err error) {
+	if r.s == nil { // fast path of Eval
+		if err := r.enterPlain(e, true); err != nil {
+			return nil, err
+		}
+		return e.values(r, env)
 	}
-	res, err := operation.Perform(env, e.expr[1:])
+	v, r, err := r.enter(e, env, true)
 	if err != nil {
 		return nil, err
 	}
-	return res, err
+	defer func() { v.exit(res, err) }()
+	return e.values(r, env)
+}
+
+func (e *Vector) values(r run, env Environment) (interface{}, error) {
+	values := make([]interface{}, len(e.items))
+	for i, x := range e.items {
+		var err error
+		values[i], err = evalIn(r, env, x)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return typedSlice(values), nil
+}
+
+func typedSlice(values []interface{}) interface{} {
+	if len(values) == 0 || values[0] == nil {
+		return values
+	}
+	tp := reflect.TypeOf(values[0])
+	for _, v := range values[1:] {
+		if reflect.TypeOf(v) != tp {
+			return values
+		}
+	}
+	res := reflect.MakeSlice(reflect.SliceOf(tp), len(values), len(values))
+	for i, v := range values {
+		res.Index(i).Set(reflect.ValueOf(v))
+	}
+	return res.Interface()
+}
+
+// Map is a braced sequence of keys and values: {"a" 1 "b" x}.
+type Map struct {
+	items []Expression // keys and values in turn
+	pos   Position
+	span  Span
+}
+
+// NewMap creates map node. Items are keys and values in turn, so the number of items have to be even.
+func NewMap(items []Expression, pos Position) *Map {
+	return &Map{items: items, pos: pos}
+}
+
+// Items returns keys and values in turn.
+func (e *Map) Items() []Expression {
+	return e.items
+}
+
+// Position of opening bracket in the source.
+func (e *Map) Position() Position {
+	return e.pos
+}
+
+// Span of map in the source, including brackets.
+func (e *Map) Span() Span {
+	return e.span
+}
+
+func (e *Map) String() string {
+	return fmt.Sprintf("MAP:%s@%s", e.items, e.pos)
+}
+
+// Eval evaluates all keys and values and returns map[string]interface{}.
+// Keys have to be evaluated to strings. The last value wins if keys are repeated.
+// MapValueError is returned if the number of items is odd.
+func (e *Map) Eval(env Environment) (interface{}, error) {
+	return e.eval(run{}, env)
+}
+
+func (e *Map) eval(r run, env Environment) (res interface{}, err error) {
+	if r.s == nil { // fast path of Eval
+		if err := r.enterPlain(e, true); err != nil {
+			return nil, err
+		}
+		return e.values(r, env)
+	}
+	v, r, err := r.enter(e, env, true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { v.exit(res, err) }()
+	return e.values(r, env)
+}
+
+func (e *Map) values(r run, env Environment) (interface{}, error) {
+	if len(e.items)%2 != 0 {
+		return nil, &MapValueError{Expr: e.items[len(e.items)-1], Position: e.pos, Span: e.span}
+	}
+	values := make(map[string]interface{}, len(e.items)/2)
+	for i := 0; i < len(e.items); i += 2 {
+		k, err := evalIn(r, env, e.items[i])
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, &MapKeyError{Key: k, Expr: e.items[i], Position: e.pos, Span: e.span}
+		}
+		values[key], err = evalIn(r, env, e.items[i+1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
 }
@@ -0,0 +1,182 @@
+package milisp_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+func TestQuote(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		tree string
+		res  string
+	}{
+		{"'x", "QUOTE:SYM:x@1:2@1:1", `"SYM:x@1:2"`},
+		{"'1", "QUOTE:INT:1@1:2@1:1", "1"},
+		{"(quote \"s\")", "QUOTE:STR:s@1:8@1:1", `"s"`},
+		{"'()", "QUOTE:[]@1:2@1:1", "[]interface {}{}"},
+		{
+			"' (a 1 1.5 \"s\" (b) 'c)",
+			"QUOTE:[SYM:a@1:4 INT:1@1:6 NUM:1.5@1:8 STR:s@1:12 [SYM:b@1:17]@1:16 QUOTE:SYM:c@1:21@1:20]@1:3@1:1",
+			`[]interface {}{"SYM:a@1:4", 1, 1.5, "s", []interface {}{"SYM:b@1:17"}, "QUOTE:SYM:c@1:21@1:20"}`,
+		},
+		{"(quote (quote x))", "QUOTE:QUOTE:SYM:x@1:15@1:8@1:1", `"QUOTE:SYM:x@1:15@1:8"`},
+		{"'#;a b", "QUOTE:SYM:b@1:6@1:1", `"SYM:b@1:6"`},
+		{"'[1 2]", "QUOTE:VEC:[INT:1@1:3 INT:2@1:5]@1:2@1:1", "[]int64{1, 2}"},
+		{`'{"a" 1}`, `QUOTE:MAP:[STR:a@1:3 INT:1@1:7]@1:2@1:1`, `map[string]interface {}{"a":1}`},
+		{`'{a x}`, `QUOTE:MAP:[SYM:a@1:3 SYM:x@1:5]@1:2@1:1`, ""},
+		{"(a'b)", "[SYM:a'b@1:2]@1:1", ""},
+		{"(quote)", "", "parser error: quote expects exactly one expression at 1:1"},
+		{"(quote a b)", "", "parser error: quote expects exactly one expression at 1:1"},
+		{"(a ')", "", "parser error: nothing to quote by ' at 1:4"},
+		{"'", "", "parser error: nothing to quote by ' at 1:1"},
+	} {
+		c := c
+		t.Run(c.text, func(t *testing.T) {
+			expr, err := milisp.Compile(c.text)
+			if err != nil {
+				if c.tree != "" || err.Error() != c.res {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				return
+			}
+			if fmt.Sprint(expr) != c.tree {
+				t.Errorf("Unexpected tree: %s", expr)
+			}
+			q, ok := expr.(*milisp.Quote)
+			if !ok {
+				return
+			}
+			res, err := q.Eval(milisp.Environment{})
+			if err != nil {
+				var target *milisp.MapKeyError
+				if c.res != "" || !errors.As(err, &target) {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				return
+			}
+			if data(res) != c.res {
+				t.Errorf("Unexpected result: %s", data(res))
+			}
+		})
+	}
+}
+
+// data renders value of quote, it shows nodes in the same way as fmt.Sprint does.
+func data(v interface{}) string {
+	switch x := v.(type) {
+	case milisp.Node:
+		return fmt.Sprintf("%q", fmt.Sprint(x))
+	case []interface{}:
+		s := "[]interface {}{"
+		for i, y := range x {
+			if i > 0 {
+				s += ", "
+			}
+			s += data(y)
+		}
+		return s + "}"
+	}
+	return fmt.Sprintf("%#v", v)
+}
+
+func ExampleQuote() {
+	expr, err := milisp.Compile(`(list '("095" "495") (quote (a b)))`)
+	if err != nil {
+		panic(err)
+	}
+	for _, x := range expr.(*milisp.List).Items()[1:] {
+		v, err := x.Eval(milisp.Environment{})
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%s %q\n", x, v)
+	}
+	// Output:
+	// QUOTE:[STR:095@1:9 STR:495@1:15]@1:8@1:7 ["095" "495"]
+	// QUOTE:[SYM:a@1:30 SYM:b@1:32]@1:29@1:22 ["SYM:a@1:30" "SYM:b@1:32"]
+}
+
+func TestVector(t *testing.T) {
+	env := milisp.Environment{"x": 1.5, "y": "s", "z": nil}
+	for _, c := range []struct {
+		text string
+		res  string
+	}{
+		{"[]", "[]interface {}{}"},
+		{"[1 2 3]", "[]int64{1, 2, 3}"},
+		{"[1.5 x]", "[]float64{1.5, 1.5}"},
+		{`[y "t"]`, `[]string{"s", "t"}`},
+		{"[1 1.5]", "[]interface {}{1, 1.5}"},
+		{"[z z]", "[]interface {}{interface {}(nil), interface {}(nil)}"},
+		{"[[1] [2 3]]", "[][]int64{[]int64{1}, []int64{2, 3}}"},
+		{`[{} {"a" x}]`, `[]map[string]interface {}{map[string]interface {}{}, map[string]interface {}{"a":1.5}}`},
+		{`{"a" 1 y [x] "a" 2}`, `map[string]interface {}{"a":2, "s":[]float64{1.5}}`},
+	} {
+		c := c
+		t.Run(c.text, func(t *testing.T) {
+			res, err := milisp.EvalCode(env, c.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%#v", res) != c.res {
+				t.Errorf("Unexpected result: %#v", res)
+			}
+		})
+	}
+	_, err := milisp.EvalCode(env, "[1 {x 1}]")
+	var target *milisp.MapKeyError
+	if !errors.As(err, &target) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	_, err = milisp.EvalCode(env, "[1 (w)]")
+	if err == nil {
+		t.Error("Error expected")
+	}
+}
+
+func TestMap_oddItems(t *testing.T) {
+	items := []milisp.Expression{
+		milisp.NewString("a", milisp.Position{Line: 1, Column: 2}),
+		milisp.NewInteger(1, milisp.Position{Line: 1, Column: 6}),
+		milisp.NewString("b", milisp.Position{Line: 1, Column: 8}),
+	}
+	for _, expr := range []milisp.Expression{
+		milisp.NewMap(items, milisp.Position{Line: 1, Column: 1}),
+		milisp.NewQuote(milisp.NewMap(items, milisp.Position{Line: 1, Column: 1}), milisp.Position{}),
+	} {
+		_, err := expr.Eval(milisp.Environment{})
+		var target *milisp.MapValueError
+		if !errors.As(err, &target) {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err.Error() != `runtime error: map key STR:b@1:8 has no value in map at 1:1` {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+}
+
+func ExampleVector() {
+	env := milisp.Environment{
+		"weight":  0.5,
+		"country": "UK",
+	}
+	res, err := milisp.EvalCode(env, `[
+		[1 weight 0.25]
+		{"country" country "codes" ["+44" "020"]}
+	]`)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%T\n", res)
+	for _, x := range res.([]interface{}) {
+		fmt.Printf("%T %v\n", x, x)
+	}
+	// Output:
+	// []interface {}
+	// []interface {} [1 0.5 0.25]
+	// map[string]interface {} map[codes:[+44 020] country:UK]
+}
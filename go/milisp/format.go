@@ -0,0 +1,464 @@
+package milisp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultIndent = "  "
+	defaultWidth  = 80
+)
+
+// Printer turns expressions back into source text.
+// The list is kept on one line if it fits Width, otherwise
+// every argument goes to the separate line indented by Indent:
+//
+//	(vector
+//	  (and (in code UK) (in area LDN))
+//	  (and (in code IL) (in area TLV)))
+//
+// Vectors and maps are split in the same way, however keys and values of map are kept in pairs.
+// Quoted expression is printed as 'x, it is split like any other one.
+// The expressions of Program are printed one per line.
+// Zero value uses two spaces and 80 chars.
+type Printer struct {
+	Indent string
+	Width  int
+}
+
+// Fprint writes formatted expression to w.
+func (p Printer) Fprint(w io.Writer, e Expression) error {
+	exprs := []Expression{e}
+	if prog, ok := e.(*Program); ok {
+		exprs = prog.exprs
+	}
+	items := make([]*layout, len(exprs))
+	for i, x := range exprs {
+		var err error
+		items[i], err = newLayout(x)
+		if err != nil {
+			return err
+		}
+	}
+	b := bytes.Buffer{}
+	p.program(&b, items, nil)
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// FormatSource compiles program and returns it in canonical layout with trailing newline.
+// Comments are kept: comment on the same line after expression stays there, all other comments
+// are placed on separate lines before the following expression. Expression that contains comments
+// is split to lines even if it fits Width. Empty lines between top level expressions are kept too.
+func (p Printer) FormatSource(text string, opts ...Option) (string, error) {
+	nodes, tail, err := parseSyntaxProgram(text, opts)
+	if err != nil {
+		return "", err
+	}
+	items := make([]*layout, len(nodes))
+	for i, n := range nodes {
+		items[i], err = newSyntaxLayout(n, true)
+		if err != nil {
+			return "", err
+		}
+	}
+	b := bytes.Buffer{}
+	p.program(&b, items, comments(tail, true))
+	b.WriteString("\n")
+	return b.String(), nil
+}
+
+// layout is an expression prepared for printing. Widths are computed once, bottom-up,
+// so printing takes linear time even for deeply nested expressions.
+type layout struct {
+	text      string    // atom, opening bracket or apostrophe of quote
+	closing   string    // closing bracket, empty for atoms and quotes
+	items     []*layout // items of list, vector or map; quoted expression
+	step      int       // 2 for maps: key and value are kept on the same line
+	width     int       // width of flat text
+	leading   []string  // comments before expression; empty string means empty line (top level only)
+	trailing  string    // comment on the same line after expression
+	inner     []string  // comments before closing bracket
+	commented bool      // there are comments inside, so expression can not be flat
+}
+
+func (l *layout) isQuote() bool {
+	return l.text == "'"
+}
+
+func (l *layout) isAtom() bool {
+	return l.items == nil && !l.isQuote() && l.closing == ""
+}
+
+// add appends nested item and accounts its width and comments.
+func (l *layout) add(x *layout) {
+	if len(l.items) > 0 {
+		l.width++ // space
+	}
+	l.items = append(l.items, x)
+	l.width += x.width
+	l.commented = l.commented || x.commented || len(x.leading) > 0 || x.trailing != ""
+}
+
+func newLayout(e Expression) (*layout, error) {
+	if q, ok := e.(*Quote); ok {
+		x, err := newLayout(q.datum)
+		if err != nil {
+			return nil, err
+		}
+		l := &layout{text: "'", width: 1}
+		l.add(x)
+		return l, nil
+	}
+	node, items := children(e)
+	if node == nil {
+		s, err := formatFlat(e)
+		if err != nil {
+			return nil, err
+		}
+		return &layout{text: s, width: utf8.RuneCountInString(s)}, nil
+	}
+	l := newContainer(node)
+	for _, x := range items {
+		y, err := newLayout(x)
+		if err != nil {
+			return nil, err
+		}
+		l.add(y)
+	}
+	return l, nil
+}
+
+func newContainer(node Node) *layout {
+	open, closing := brackets(node)
+	l := &layout{text: open, closing: closing, step: 1, width: 2, items: []*layout{}}
+	if _, ok := node.(*Map); ok {
+		l.step = 2
+	}
+	return l
+}
+
+// newSyntaxLayout prepares expression of lossless syntax tree with its comments.
+// Quote is always printed as 'x, comments of (quote x) form are moved before x.
+func newSyntaxLayout(n *SyntaxNode, top bool) (*layout, error) {
+	var l *layout
+	switch e := n.Expr.(type) {
+	case *Quote:
+		datum := n.Children[len(n.Children)-1]
+		x, err := newSyntaxLayout(datum, false)
+		if err != nil {
+			return nil, err
+		}
+		if n.IsList() {
+			moved := comments(n.Children[0].Leading, false)
+			moved = append(moved, comments(n.Children[0].Trailing, false)...)
+			x.leading = append(moved, x.leading...)
+			x.trailing = joinComments(x.trailing, comments(n.Inner, false))
+		}
+		l = &layout{text: "'", width: 1}
+		l.add(x)
+	case *List, *Vector, *Map:
+		l = newContainer(e.(Node)) //nolint:forcetypeassert // they are nodes
+		for _, c := range n.Children {
+			x, err := newSyntaxLayout(c, false)
+			if err != nil {
+				return nil, err
+			}
+			l.add(x)
+		}
+		l.inner = comments(n.Inner, false)
+		l.commented = l.commented || len(l.inner) > 0
+	default:
+		s, err := formatFlat(e)
+		if err != nil {
+			return nil, err
+		}
+		l = &layout{text: s, width: utf8.RuneCountInString(s)}
+	}
+	l.leading = comments(n.Leading, top)
+	l.trailing = joinComments("", comments(n.Trailing, false))
+	if l.isQuote() { // comment after quoted expression is comment after quote
+		x := l.items[0]
+		l.trailing, x.trailing = joinComments(x.trailing, []string{l.trailing}), ""
+	}
+	return l, nil
+}
+
+// comments picks comments from trivia. If blank is set, empty line is marked by empty string.
+// Lex ends every space token by newline, so two newlines in a row make empty line.
+func comments(tokens []Token, blank bool) []string {
+	res := []string(nil)
+	newLines := 0
+	for _, t := range tokens {
+		switch {
+		case t.Kind == TokenComment:
+			if blank && newLines > 1 {
+				res = append(res, "")
+			}
+			res = append(res, t.Text)
+			newLines = 0
+		case hasNewLine(t.Text):
+			newLines++
+		}
+	}
+	if blank && newLines > 1 {
+		res = append(res, "")
+	}
+	return res
+}
+
+func joinComments(s string, cc []string) string {
+	for _, c := range cc {
+		if c == "" {
+			continue
+		}
+		if s != "" {
+			s += " "
+		}
+		s += c
+	}
+	return s
+}
+
+// program prints top level expressions and comments at the end, one per line.
+func (p Printer) program(b *bytes.Buffer, items []*layout, tail []string) {
+	p = p.withDefaults()
+	for i, l := range items {
+		for k, c := range l.leading {
+			if c == "" {
+				if i > 0 || k > 0 {
+					b.WriteString("\n")
+				}
+				continue
+			}
+			b.WriteString(c)
+			b.WriteString("\n")
+		}
+		col := p.print(b, l, 0, 0)
+		if l.trailing != "" {
+			p.write(b, " "+l.trailing, col)
+		}
+		if i < len(items)-1 || len(tail) > 0 {
+			b.WriteString("\n")
+		}
+	}
+	for i, c := range tail {
+		if c == "" {
+			if i < len(tail)-1 && b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			continue
+		}
+		b.WriteString(c)
+		if i < len(tail)-1 {
+			b.WriteString("\n")
+		}
+	}
+}
+
+func (p Printer) withDefaults() Printer {
+	if p.Indent == "" {
+		p.Indent = defaultIndent
+	}
+	if p.Width <= 0 {
+		p.Width = defaultWidth
+	}
+	return p
+}
+
+// print writes expression that starts at column col and returns column right after it.
+func (p Printer) print(b *bytes.Buffer, l *layout, depth, col int) int {
+	fits := !l.commented && col+l.width <= p.Width
+	switch {
+	case l.isAtom():
+		return p.write(b, l.text, col)
+	case l.isQuote() && !fits:
+		b.WriteString(l.text)
+		return p.item(b, l.items[0], depth, col+1, false)
+	case fits || !l.commented && len(l.items) < 2:
+		p.flat(b, l)
+		return col + l.width
+	}
+	b.WriteString(l.text)
+	col++
+	indent := strings.Repeat(p.Indent, depth+1)
+	broken := false // the next item has to start on the new line: previous one has comment after it
+	for i, x := range l.items {
+		switch {
+		case i == 0 && len(x.leading) == 0:
+		case i%l.step == 0 || broken || len(x.leading) > 0:
+			col = p.newLine(b, indent)
+		default:
+			b.WriteString(" ")
+			col++
+		}
+		col = p.item(b, x, depth+1, col, true)
+		broken = x.trailing != ""
+	}
+	for _, c := range l.inner {
+		col = p.newLine(b, indent)
+		col = p.write(b, c, col)
+		broken = true
+	}
+	if broken {
+		col = p.newLine(b, strings.Repeat(p.Indent, depth))
+	}
+	b.WriteString(l.closing)
+	return col + 1
+}
+
+// item prints nested expression with its comments. Expression starts on the new line if it has leading comments.
+func (p Printer) item(b *bytes.Buffer, x *layout, depth, col int, started bool) int {
+	indent := strings.Repeat(p.Indent, depth)
+	for _, c := range x.leading {
+		if c == "" {
+			continue
+		}
+		if !started {
+			col = p.newLine(b, indent)
+		}
+		col = p.write(b, c, col)
+		col = p.newLine(b, indent)
+		started = true
+	}
+	col = p.print(b, x, depth, col)
+	if x.trailing != "" {
+		col = p.write(b, " "+x.trailing, col)
+	}
+	return col
+}
+
+func (p Printer) flat(b *bytes.Buffer, l *layout) {
+	b.WriteString(l.text)
+	for i, x := range l.items {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		p.flat(b, x)
+	}
+	b.WriteString(l.closing)
+}
+
+func (p Printer) newLine(b *bytes.Buffer, indent string) int {
+	b.WriteString("\n")
+	b.WriteString(indent)
+	return utf8.RuneCountInString(indent)
+}
+
+// write writes text that can contain newlines (like block comment) and returns column after it.
+func (p Printer) write(b *bytes.Buffer, s string, col int) int {
+	b.WriteString(s)
+	if k := strings.LastIndexByte(s, '\n'); k >= 0 {
+		return utf8.RuneCountInString(s[k+1:])
+	}
+	return col + utf8.RuneCountInString(s)
+}
+
+func brackets(n Node) (string, string) {
+	switch n.(type) {
+	case *Vector:
+		return "[", "]"
+	case *Map:
+		return "{", "}"
+	default: // case *List:
+		return "(", ")"
+	}
+}
+
+func formatFlat(e Expression) (string, error) {
+	switch n := e.(type) {
+	case *Symbol:
+		if !isValidSymbol(n.name) {
+			return "", fmt.Errorf("can not format symbol %q", n.name)
+		}
+		return n.name, nil
+	case *Number:
+		return n.text, nil
+	case *Integer:
+		return n.text, nil
+	case *Literal:
+		return n.text, nil
+	case *String:
+		return quote(n.value), nil
+	case *Quote:
+		s, err := formatFlat(n.datum)
+		if err != nil {
+			return "", err
+		}
+		return "'" + s, nil
+	case *List, *Vector, *Map:
+		node, items := children(n)
+		s := make([]string, len(items))
+		for i, x := range items {
+			var err error
+			s[i], err = formatFlat(x)
+			if err != nil {
+				return "", err
+			}
+		}
+		open, closing := brackets(node)
+		return open + strings.Join(s, " ") + closing, nil
+	default:
+		return "", fmt.Errorf("can not format %T", e)
+	}
+}
+
+// isValidSymbol checks if name is tokenized back into the same symbol.
+func isValidSymbol(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, ch := range name {
+		tp, _ := charType(ch)
+		switch {
+		case tp == cOther, tp == cBar, tp == cSemicolon:
+		case tp == cApostrophe && i > 0: // ' at the beginning is quote
+		default:
+			return false
+		}
+	}
+	t, err := tokenize(name, &config{})
+	return err == nil && len(t) == 1 && t[0].tp == tpSymbol
+}
+
+func quote(s string) string {
+	b := strings.Builder{}
+	b.WriteByte('"')
+	for _, ch := range s {
+		switch {
+		case ch == '"' || ch == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(ch)
+		case ch == '\n' || ch == '\t' || ch == '\r' || unicode.IsPrint(ch):
+			// raw whitespace is kept: Python reads \n, \t and \r as n, t and r
+			b.WriteRune(ch)
+		case ch <= 0xffff:
+			fmt.Fprintf(&b, `\u%04x`, ch)
+		default:
+			fmt.Fprintf(&b, `\U%08x`, ch)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Format returns canonical text of expression.
+func Format(e Expression) (string, error) {
+	b := strings.Builder{}
+	err := Printer{}.Fprint(&b, e)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// FormatSource compiles program and returns it in canonical layout with trailing newline.
+// Comments are kept, see Printer.FormatSource.
+func FormatSource(text string, opts ...Option) (string, error) {
+	return Printer{}.FormatSource(text, opts...)
+}
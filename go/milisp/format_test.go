@@ -0,0 +1,284 @@
+package milisp_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+func TestFormat_roundTrip(t *testing.T) {
+	for _, text := range []string{
+		"A",
+		"()",
+		"(A())",
+		"(A(X Y)A)",
+		`(concat "it is quote: \"" "it is slash: \\" "multi
+line")`,
+		`(concat "\t\r\n" "\u0000\u00a0\u2028" "\U000e0001" "\U0001F600" "ф")`,
+		"(+ 1 -2.5 1e3 0x10 1_000 -0x_7fff_ffff_ffff_ffff 007 1.0)",
+		"(vector (and (in phoneCountryCode UK) (in phoneAreaCode LDN))" +
+			" (and (in phoneCountryCode IL) (in phoneAreaCode TLV)))",
+		`(in code '("095" "495" ("x" y 1)) (quote a) ''b)`,
+		`(f [] [1 2.5 "s" (g x) [y]] {} {"a" 1 b [c {}]} '[x {y z}])`,
+		"(f don't a|b a;b 'x'y '|a)",
+	} {
+		text := text
+		t.Run(text, func(t *testing.T) {
+			expr, err := milisp.Compile(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			formatted, err := milisp.Format(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := milisp.Compile(formatted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			formattedAgain, err := milisp.Format(again)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if formatted != formattedAgain {
+				t.Errorf("Unstable result:\n%s\n%s", formatted, formattedAgain)
+			}
+			if fmt.Sprint(stripPositions(expr)) != fmt.Sprint(stripPositions(again)) {
+				t.Errorf("Different trees:\n%s\n%s", expr, again)
+			}
+		})
+	}
+}
+
+// stripPositions renders tree without positions to compare trees obtained from different texts.
+func stripPositions(e milisp.Expression) string {
+	switch n := e.(type) {
+	case *milisp.List:
+		s := "["
+		for i, x := range n.Items() {
+			if i > 0 {
+				s += " "
+			}
+			s += stripPositions(x)
+		}
+		return s + "]"
+	case *milisp.Symbol:
+		return "SYM:" + n.Name()
+	case *milisp.Number:
+		return fmt.Sprintf("NUM:%v", n.Value())
+	case *milisp.Integer:
+		return fmt.Sprintf("INT:%v", n.Value())
+	case *milisp.String:
+		return fmt.Sprintf("STR:%q", n.Value())
+	case *milisp.Quote:
+		return "QUOTE:" + stripPositions(n.Datum())
+	case *milisp.Vector:
+		return "VEC:" + stripPositions(milisp.NewList(n.Items(), milisp.Position{}))
+	case *milisp.Map:
+		return "MAP:" + stripPositions(milisp.NewList(n.Items(), milisp.Position{}))
+	}
+	return fmt.Sprintf("%T", e)
+}
+
+func TestFormat_constructedNumbers(t *testing.T) {
+	list := milisp.NewList([]milisp.Expression{
+		milisp.NewNumber(3, milisp.Position{}),
+		milisp.NewNumber(0.5, milisp.Position{}),
+		milisp.NewNumber(1e100, milisp.Position{}),
+		milisp.NewInteger(-3, milisp.Position{}),
+	}, milisp.Position{})
+	text, err := milisp.Format(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "(3.0 0.5 1e+100 -3)" {
+		t.Errorf("Unexpected result: %s", text)
+	}
+}
+
+func TestFormat_strings(t *testing.T) {
+	list := milisp.NewList([]milisp.Expression{
+		milisp.NewString("a\tb\nc\rd", milisp.Position{}),
+		milisp.NewString(`q"s\`, milisp.Position{}),
+		milisp.NewString("\x00\u2028", milisp.Position{}),
+	}, milisp.Position{})
+	text, err := milisp.Format(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "(\"a\tb\nc\rd\" \"q\\\"s\\\\\" \"\\u0000\\u2028\")" {
+		t.Errorf("Unexpected result: %q", text)
+	}
+}
+
+func TestFormat_errors(t *testing.T) {
+	for _, e := range []milisp.Expression{
+		nil,
+		milisp.NewSymbol("", milisp.Position{}),
+		milisp.NewSymbol("a b", milisp.Position{}),
+		milisp.NewSymbol("1", milisp.Position{}),
+		milisp.NewList([]milisp.Expression{milisp.NewSymbol("(", milisp.Position{})}, milisp.Position{}),
+		milisp.NewQuote(milisp.NewSymbol("'", milisp.Position{}), milisp.Position{}),
+	} {
+		e := e
+		t.Run(fmt.Sprint(e), func(t *testing.T) {
+			_, err := milisp.Format(e)
+			if err == nil {
+				t.Error("Error expected")
+			}
+		})
+	}
+}
+
+func TestFormatSource_comments(t *testing.T) {
+	for _, c := range []struct {
+		text     string
+		expected string
+	}{
+		{"#keep-me\n(a #;(disabled) b) #| block |#", "#keep-me\n(a #;(disabled)\n  b) #| block |#\n"},
+		{"(a b #c\n)", "(a\n  b #c\n)\n"},
+		{"(a b\n  #c\n  )", "(a\n  b\n  #c\n)\n"},
+		{"(#c\n a)", "(\n  #c\n  a)\n"},
+		{"{\"a\" 1 #c\n \"b\" #d\n 2}", "{\"a\" 1 #c\n  \"b\" #d\n  2}\n"},
+		{"'(a #c\n b)", "'(a #c\n  b)\n"},
+		{"(f 'x #c\n y)", "(f\n  'x #c\n  y)\n"},
+		{"(f (quote #c\n x))", "(f\n  '\n  #c\n  x)\n"},
+		{"(f #;(g\n  x) y)", "(f #;(g\n  x)\n  y)\n"},
+		{"a\n\n\n#c\n\nb #d\n\n#e\n", "a\n\n#c\n\nb #d\n\n#e\n"},
+		{"#only comment\n", "#only comment\n"},
+		{"", "\n"},
+	} {
+		c := c
+		t.Run(c.text, func(t *testing.T) {
+			formatted, err := milisp.FormatSource(c.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if formatted != c.expected {
+				t.Errorf("Unexpected result:\n%s\n%q", formatted, formatted)
+			}
+			again, err := milisp.FormatSource(formatted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != formatted {
+				t.Errorf("Unstable result:\n%s\n%s", formatted, again)
+			}
+			if commentsOf(t, c.text) != commentsOf(t, formatted) {
+				t.Errorf("Comments are lost: %s", formatted)
+			}
+		})
+	}
+}
+
+func commentsOf(t *testing.T, text string) string {
+	t.Helper()
+	tokens, err := milisp.Lex(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := []string(nil)
+	for _, x := range tokens {
+		if x.Kind == milisp.TokenComment {
+			cc = append(cc, x.Text)
+		}
+	}
+	return strings.Join(cc, "|")
+}
+
+func ExamplePrinter() {
+	expr, err := milisp.Compile(`(vector
+	(and (in phoneCountryCode UK) (in phoneAreaCode LDN))
+	(and (in phoneCountryCode IL) (in phoneAreaCode TLV)) (label "one-hot")
+	(in phoneAreaCode '("020" "095" "495" "3" "7" "8" "10" "11" "12" "13" "14")))`)
+	if err != nil {
+		panic(err)
+	}
+	text, err := milisp.Format(expr)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(text)
+	fmt.Println()
+	b := strings.Builder{}
+	err = milisp.Printer{Indent: "    ", Width: 40}.Fprint(&b, expr)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(b.String())
+	// Output:
+	// (vector
+	//   (and (in phoneCountryCode UK) (in phoneAreaCode LDN))
+	//   (and (in phoneCountryCode IL) (in phoneAreaCode TLV))
+	//   (label "one-hot")
+	//   (in phoneAreaCode '("020" "095" "495" "3" "7" "8" "10" "11" "12" "13" "14")))
+	//
+	// (vector
+	//     (and
+	//         (in phoneCountryCode UK)
+	//         (in phoneAreaCode LDN))
+	//     (and
+	//         (in phoneCountryCode IL)
+	//         (in phoneAreaCode TLV))
+	//     (label "one-hot")
+	//     (in
+	//         phoneAreaCode
+	//         '("020"
+	//             "095"
+	//             "495"
+	//             "3"
+	//             "7"
+	//             "8"
+	//             "10"
+	//             "11"
+	//             "12"
+	//             "13"
+	//             "14")))
+}
+
+func ExamplePrinter_vectorsAndMaps() {
+	expr, err := milisp.Compile(`(model
+	[0.5 0.25 0.125 0.0625 0.03125 0.015625 0.0078125 0.00390625 0.001953125]
+	{"UK" [44 "London"] "IL" [972 "Tel Aviv"] "RU" [7 "Moscow"] "DE" [49 "Berlin"]})`)
+	if err != nil {
+		panic(err)
+	}
+	text, err := milisp.Format(expr)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(text)
+	// Output:
+	// (model
+	//   [0.5 0.25 0.125 0.0625 0.03125 0.015625 0.0078125 0.00390625 0.001953125]
+	//   {"UK" [44 "London"]
+	//     "IL" [972 "Tel Aviv"]
+	//     "RU" [7 "Moscow"]
+	//     "DE" [49 "Berlin"]})
+}
+
+func ExampleFormatSource() {
+	text, err := milisp.FormatSource(`# sum
+(+   1
+	2 # the second one
+	)   (- 3
+
+
+	#| the last one |# 4)`)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(text)
+	// Output:
+	// # sum
+	// (+
+	//   1
+	//   2 # the second one
+	// )
+	// (-
+	//   3
+	//   #| the last one |#
+	//   4)
+}
@@ -1,7 +1,9 @@
 package milisp
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"strconv"
 )
 
@@ -14,11 +16,30 @@ func EvalFloat(env Environment, e Expression) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
+	return toFloat(r, e)
+}
+
+// EvalFloatContext is like EvalFloat, however it evaluates expression by EvalContext.
+// ContextOperation uses it to keep evaluation of ctx: cancellation, limits, tracer and debugger.
+func EvalFloatContext(ctx context.Context, env Environment, e Expression) (float64, error) {
+	if e == nil {
+		return 0, fmt.Errorf("nil interface")
+	}
+	r, err := EvalContext(ctx, env, e)
+	if err != nil {
+		return 0, err
+	}
+	return toFloat(r, e)
+}
+
+func toFloat(r interface{}, e Expression) (float64, error) {
 	switch v := r.(type) {
 	case float64:
 		return v, nil
 	case int:
 		return float64(v), nil
+	case int64:
+		return float64(v), nil
 	case bool:
 		if v {
 			return 1, nil
@@ -35,6 +56,58 @@ func EvalFloat(env Environment, e Expression) (float64, error) {
 	}
 }
 
+// EvalInt is a shortcut for Exec + cast to int64.
+// Float is converted only if it is integral and fits int64.
+func EvalInt(env Environment, e Expression) (int64, error) {
+	if e == nil {
+		return 0, fmt.Errorf("nil interface")
+	}
+	r, err := e.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+	return toInt(r, e)
+}
+
+// EvalIntContext is like EvalInt, however it evaluates expression by EvalContext, see EvalFloatContext.
+func EvalIntContext(ctx context.Context, env Environment, e Expression) (int64, error) {
+	if e == nil {
+		return 0, fmt.Errorf("nil interface")
+	}
+	r, err := EvalContext(ctx, env, e)
+	if err != nil {
+		return 0, err
+	}
+	return toInt(r, e)
+}
+
+func toInt(r interface{}, e Expression) (int64, error) {
+	switch v := r.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, fmt.Errorf("can not convert to int %v while executing %s", v, e)
+		}
+		return int64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("can not convert to int %v while executing %s", v, e)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("can not cast %T to int64 (not implemented): %s", r, e)
+	}
+}
+
 // EvalString is a shortcut for Exec + cast to string.
 func EvalString(env Environment, e Expression) (string, error) {
 	if e == nil {
@@ -44,6 +117,31 @@ func EvalString(env Environment, e Expression) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	return toString(r, e)
+}
+
+// EvalStringContext is like EvalString, however it evaluates expression by EvalContext, see EvalFloatContext.
+func EvalStringContext(ctx context.Context, env Environment, e Expression) (string, error) {
+	if e == nil {
+		return "", fmt.Errorf("nil interface")
+	}
+	r, err := EvalContext(ctx, env, e)
+	if err != nil {
+		return "", err
+	}
+	return toString(r, e)
+}
+
+// SymbolName returns the name of bare symbol without evaluation, like the name of variable in (set x 1).
+func SymbolName(e Expression) (string, error) {
+	s, ok := e.(*Symbol)
+	if !ok {
+		return "", fmt.Errorf("symbol expected: %s", e)
+	}
+	return s.name, nil
+}
+
+func toString(r interface{}, e Expression) (string, error) {
 	switch v := r.(type) {
 	case string:
 		return v, nil
@@ -1,6 +1,8 @@
 package milisp_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -23,6 +25,7 @@ func TestEvalFloat(t *testing.T) {
 		{expr, true, true, 1., false},
 		{expr, true, false, 0., false},
 		{expr, true, 100, 100., false},
+		{expr, true, int64(100), 100., false},
 		{expr, true, "100", 100., false},
 		{expr, true, "x", 0., true},
 		{expr, true, nil, 0., true},
@@ -52,6 +55,54 @@ func TestEvalFloat(t *testing.T) {
 	}
 }
 
+func TestEvalInt(t *testing.T) {
+	expr, err := milisp.Compile("X")
+	if err != nil {
+		t.Error(err)
+	}
+	for _, c := range []struct {
+		expr    milisp.Expression
+		set     bool
+		val     interface{}
+		num     int64
+		isError bool
+	}{
+		{expr, true, true, 1, false},
+		{expr, true, false, 0, false},
+		{expr, true, 100, 100, false},
+		{expr, true, int64(1) << 62, 1 << 62, false},
+		{expr, true, 100., 100, false},
+		{expr, true, 100.5, 0, true},
+		{expr, true, 1e19, 0, true},
+		{expr, true, "100", 100, false},
+		{expr, true, "x", 0, true},
+		{expr, true, nil, 0, true},
+		{expr, false, nil, 0, true},
+		{nil, false, nil, 0, true},
+	} {
+		c := c
+		t.Run(fmt.Sprintf("%v-%d", c.val, c.num), func(t *testing.T) {
+			env := milisp.Environment{}
+			if c.set {
+				env["X"] = c.val
+			}
+			n, err := milisp.EvalInt(env, c.expr)
+			if c.isError {
+				if err == nil {
+					t.Error("Error expected")
+				}
+			} else {
+				if err != nil {
+					t.Error(err)
+				}
+				if n != c.num {
+					t.Error(n)
+				}
+			}
+		})
+	}
+}
+
 func TestEvalString(t *testing.T) {
 	expr, err := milisp.Compile("X")
 	if err != nil {
@@ -92,6 +143,57 @@ func TestEvalString(t *testing.T) {
 	}
 }
 
+func TestEvalFloatContext(t *testing.T) {
+	env := milisp.Environment{
+		"F": milisp.ContextOpFunc(func(ctx context.Context, env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+			f, err := milisp.EvalFloatContext(ctx, env, args[0])
+			if err != nil {
+				return nil, err
+			}
+			n, err := milisp.EvalIntContext(ctx, env, args[1])
+			if err != nil {
+				return nil, err
+			}
+			s, err := milisp.EvalStringContext(ctx, env, args[2])
+			if err != nil {
+				return nil, err
+			}
+			return fmt.Sprintf("%v %v %v", f, n, s), nil
+		}),
+		"X": "1.5",
+	}
+	expr, err := milisp.Compile(`(F X 2.0 (F 1 2 "s"))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := milisp.EvalContext(context.Background(), env, expr, milisp.WithBudget(7))
+	if err != nil || res != "1.5 2 1 2 s" {
+		t.Errorf("Unexpected result: %v, %v", res, err)
+	}
+	// arguments are evaluated by the same evaluation, so they spend the same budget
+	_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithBudget(6))
+	var target *milisp.BudgetExceededError
+	if !errors.As(err, &target) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSymbolName(t *testing.T) {
+	expr, err := milisp.Compile(`(x "x")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := expr.(*milisp.List).Items()
+	name, err := milisp.SymbolName(items[0])
+	if err != nil || name != "x" {
+		t.Errorf("Unexpected name: %v, %v", name, err)
+	}
+	_, err = milisp.SymbolName(items[1])
+	if err == nil {
+		t.Error("Error expected")
+	}
+}
+
 func TestEvalCodeErrors(t *testing.T) { // all OK flows are covered by TestEval<Type>
 	env := milisp.Environment{}
 	for _, text := range []string{
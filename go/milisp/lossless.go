@@ -0,0 +1,334 @@
+package milisp
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenKind is a kind of lossless token.
+type TokenKind int
+
+// Kinds of lossless tokens. TokenSpace and TokenComment are trivia,
+// they are dropped by Compile, however they are kept by Lex and ParseSyntaxTree.
+const (
+	TokenSymbol TokenKind = iota
+	TokenNumber
+	TokenString
+	TokenOpen
+	TokenClose
+	TokenSpace
+	TokenComment
+	TokenLiteral // custom literal, see WithLiteral
+	TokenQuote   // apostrophe of 'x
+)
+
+func (k TokenKind) String() string {
+	return []string{"SYM", "NUM", "STR", "BEG", "END", "SPC", "CMT", "LIT", "QUO"}[k]
+}
+
+func tokenKind(tp int) TokenKind {
+	switch tp {
+	case tpNumber, tpInteger:
+		return TokenNumber
+	case tpString:
+		return TokenString
+	case tpOpen:
+		return TokenOpen
+	case tpClose:
+		return TokenClose
+	case tpLiteral:
+		return TokenLiteral
+	case tpComment, tpDatumComment:
+		return TokenComment
+	case tpQuote:
+		return TokenQuote
+	default: // case tpSymbol:
+		return TokenSymbol
+	}
+}
+
+// Token is a piece of source text. Concatenation of all tokens
+// obtained from Lex gives the original text byte-for-byte.
+type Token struct {
+	Kind     TokenKind
+	Text     string // exact text including quotes, escapes, comment mark, newlines
+	Position Position
+	Span     Span
+}
+
+func (t Token) String() string {
+	return t.Kind.String() + ":" + t.Text + "@" + t.Position.String()
+}
+
+func (t Token) isTrivia() bool {
+	return t.Kind == TokenSpace || t.Kind == TokenComment
+}
+
+// Lex splits text to tokens, including spaces and comments.
+// Every newline ends the space token. Line comment token doesn't include newline.
+// Block comment #|...|# and datum comment #; with commented out expression are single comment tokens.
+func Lex(text string, opts ...Option) ([]Token, error) {
+	cfg := newConfig(opts)
+	l := newLexer(strings.NewReader(text), cfg)
+	l.comments = true
+	tokens, err := collect(l)
+	if err != nil {
+		return nil, err
+	}
+	return lossless(text, tokens, cfg.source), nil
+}
+
+// lossless fills the gaps between tokens by spaces.
+func lossless(text string, tokens []universalToken, source string) []Token {
+	res := []Token(nil)
+	lineState := sLine
+	line := 1
+	pos := 1
+	loc := Location{Line: 1, Column: 1, UTF16Column: 1}
+	k := 0           // next token
+	spaceStart := -1 // start of current space or -1
+	tokenEnd := 0    // end of current token
+	startPos := Position{}
+	startLoc := Location{}
+	flush := func(end Location) {
+		if spaceStart >= 0 && end.Offset > spaceStart {
+			res = append(res, Token{
+				Kind:     TokenSpace,
+				Text:     text[spaceStart:end.Offset],
+				Position: startPos,
+				Span:     Span{Source: source, Start: startLoc, End: end},
+			})
+		}
+		spaceStart = -1
+	}
+	for offset, ch := range text {
+		tp, spTp := charType(ch)
+		_, size := utf8.DecodeRuneInString(text[offset:]) // invalid byte is one rune
+		next := nextLocation(lineState, loc, ch, size, spTp)
+		switch {
+		case offset < tokenEnd: // inside token
+		case k < len(tokens) && offset == tokens[k].span.Start.Offset:
+			flush(loc)
+			t := tokens[k]
+			k++
+			span := t.span
+			if t.tp == tpDatumComment {
+				n := skipDatum(tokens, k)
+				if n > k {
+					span.End = tokens[n-1].span.End
+				}
+				k = n
+			}
+			tokenEnd = span.End.Offset
+			res = append(res, Token{
+				Kind:     tokenKind(t.tp),
+				Text:     text[span.Start.Offset:span.End.Offset],
+				Position: Position{Line: t.line, Column: t.pos},
+				Span:     span,
+			})
+		default:
+			if spaceStart < 0 {
+				spaceStart = offset
+				startPos = Position{Line: line, Column: pos}
+				startLoc = loc
+			}
+			if tp == cNewLine {
+				flush(next)
+			}
+		}
+		lineState, line, pos = nextPosition(lineState, line, pos, spTp)
+		loc = next
+	}
+	flush(loc)
+	return res
+}
+
+// skipDatum returns index of token after expression that starts at k.
+// Comments before expression are skipped too. Unbalanced brackets are tolerated.
+func skipDatum(tokens []universalToken, k int) int {
+	for k < len(tokens) {
+		t := tokens[k]
+		k++
+		switch t.tp {
+		case tpComment:
+		case tpDatumComment:
+			k = skipDatum(tokens, k)
+		case tpQuote:
+			return skipDatum(tokens, k)
+		case tpClose:
+			return k - 1
+		case tpOpen:
+			for k < len(tokens) && tokens[k].tp != tpClose {
+				k = skipDatum(tokens, k)
+			}
+			if k < len(tokens) {
+				k++
+			}
+			return k
+		default:
+			return k
+		}
+	}
+	return k
+}
+
+// SyntaxNode is a node of lossless (concrete) syntax tree.
+// Comment on the same line after node is attached to node as Trailing,
+// all other comments are attached to the following node as Leading.
+type SyntaxNode struct {
+	Leading  []Token       // spaces and comments before node
+	Token    Token         // atom itself, opening bracket of list or apostrophe of quote
+	Children []*SyntaxNode // items of list, vector, map or quoted expression
+	Inner    []Token       // spaces and comments before closing bracket
+	Close    Token         // closing bracket of list
+	Trailing []Token       // spaces and comment on the same line after node
+	Expr     Expression    // corresponding AST node
+}
+
+// IsList reports whether node is a list, vector or map.
+func (n *SyntaxNode) IsList() bool {
+	return n.Token.Kind == TokenOpen
+}
+
+func (n *SyntaxNode) writeTo(b *strings.Builder) {
+	writeTokens(b, n.Leading)
+	b.WriteString(n.Token.Text)
+	for _, c := range n.Children {
+		c.writeTo(b)
+	}
+	if n.IsList() {
+		writeTokens(b, n.Inner)
+		b.WriteString(n.Close.Text)
+	}
+	writeTokens(b, n.Trailing)
+}
+
+func hasNewLine(text string) bool {
+	for _, ch := range text {
+		if tp, _ := charType(ch); tp == cNewLine {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTokens(b *strings.Builder, tokens []Token) {
+	for _, t := range tokens {
+		b.WriteString(t.Text)
+	}
+}
+
+// SyntaxTree is lossless representation of program.
+// It prints back to the original text byte-for-byte.
+type SyntaxTree struct {
+	Root *SyntaxNode
+	Tail []Token // spaces and comments at the end of text
+}
+
+// String returns source text.
+func (t *SyntaxTree) String() string {
+	b := strings.Builder{}
+	t.Root.writeTo(&b)
+	writeTokens(&b, t.Tail)
+	return b.String()
+}
+
+// WriteTo writes source text to w.
+func (t *SyntaxTree) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, t.String())
+	return int64(n), err
+}
+
+// ParseSyntaxTree compiles text like Compile does and keeps all comments and spaces.
+// Expression of AST is available in Root.Expr.
+func ParseSyntaxTree(text string, opts ...Option) (*SyntaxTree, error) {
+	expr, err := Compile(text, opts...)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := Lex(text, opts...)
+	if err != nil {
+		return nil, err
+	}
+	b := syntaxBuilder{tokens: tokens}
+	root := b.node(expr)
+	return &SyntaxTree{Root: root, Tail: b.tokens[b.pos:]}, nil
+}
+
+type syntaxBuilder struct {
+	tokens []Token
+	pos    int
+}
+
+func (b *syntaxBuilder) trivia() []Token {
+	start := b.pos
+	for b.pos < len(b.tokens) && b.tokens[b.pos].isTrivia() {
+		b.pos++
+	}
+	return b.tokens[start:b.pos]
+}
+
+// trailing takes spaces and comment up to the end of line, if there is comment.
+func (b *syntaxBuilder) trailing() []Token {
+	for i := b.pos; i < len(b.tokens); i++ {
+		t := b.tokens[i]
+		if t.Kind == TokenComment {
+			res := b.tokens[b.pos : i+1]
+			b.pos = i + 1
+			return res
+		}
+		if t.Kind != TokenSpace || hasNewLine(t.Text) {
+			break
+		}
+	}
+	return nil
+}
+
+// node walks AST and tokens simultaneously, Compile guarantees that they are consistent.
+func (b *syntaxBuilder) node(e Expression) *SyntaxNode {
+	n := &SyntaxNode{Expr: e}
+	n.Leading = b.trivia()
+	n.Token = b.tokens[b.pos]
+	b.pos++
+	_, items := children(e)
+	if x, ok := e.(*Quote); ok {
+		items = []Expression{x.datum}
+		if n.IsList() { // (quote x)
+			i := b.pos
+			for b.tokens[i].isTrivia() {
+				i++
+			}
+			items = []Expression{&Symbol{name: "quote", pos: b.tokens[i].Position, span: b.tokens[i].Span}, x.datum}
+		}
+	}
+	for _, x := range items {
+		n.Children = append(n.Children, b.node(x))
+	}
+	if n.IsList() {
+		n.Inner = b.trivia()
+		n.Close = b.tokens[b.pos]
+		b.pos++
+	}
+	n.Trailing = b.trailing()
+	return n
+}
+
+// parseSyntaxProgram builds lossless syntax trees of all top level expressions of program.
+// It returns trivia at the end of text too.
+func parseSyntaxProgram(text string, opts []Option) ([]*SyntaxNode, []Token, error) {
+	prog, err := CompileProgram(text, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := Lex(text, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	b := syntaxBuilder{tokens: tokens}
+	nodes := make([]*SyntaxNode, len(prog.exprs))
+	for i, e := range prog.exprs {
+		nodes[i] = b.node(e)
+	}
+	return nodes, b.tokens[b.pos:], nil
+}
@@ -0,0 +1,116 @@
+package milisp_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+func TestLex_lossless(t *testing.T) {
+	for _, text := range []string{
+		"a",
+		"  a  ",
+		"# comment only\n\n  a # last",
+		"(a\t\"b\\\"c\"\r\n 1.5)#x",
+		"(x #y\n)",
+		"(\n\t\"multi\nline\" # one\n  ## two\n\r)\n",
+		"(a #| block\n comment |# b #;c\n d #; #; (e #f\n) #|x|# g\n h)",
+		"(a #;\n\n(b\n\tc))",
+		"(f 'a ' (b) ( quote # q\n c) #;'d '#;e\n f)",
+		"[a {b c # d\n e #;[f] g}\n # h\n ]",
+		"(a #|x|#)#;#|x|#b",
+		`
+	(prog                     # execute all following expressions and return result of last
+	    (set x 1)             # x = 1
+	    (loop i 1 N           # for i = 1; i <= N; i++
+	        (set x (* x i))   # x = x * i
+	    )
+	    x                     # return x
+	)`,
+	} {
+		text := text
+		t.Run(text, func(t *testing.T) {
+			tokens, err := milisp.Lex(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := strings.Builder{}
+			end := milisp.Location{Line: 1, Column: 1, UTF16Column: 1}
+			for _, x := range tokens {
+				b.WriteString(x.Text)
+				if x.Span.Start != end || text[x.Span.Start.Offset:x.Span.End.Offset] != x.Text {
+					t.Errorf("Unexpected span: %s %s", x, x.Span)
+				}
+				end = x.Span.End
+			}
+			if b.String() != text {
+				t.Errorf("Lex: %q", b.String())
+			}
+			tree, err := milisp.ParseSyntaxTree(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tree.String() != text {
+				t.Errorf("Tree: %q", tree.String())
+			}
+		})
+	}
+}
+
+func TestParseSyntaxTree_error(t *testing.T) {
+	tree, err := milisp.ParseSyntaxTree("(a")
+	if err == nil || tree != nil {
+		t.Error("Error expected")
+	}
+	tokens, err := milisp.Lex(`"`)
+	if err == nil || tokens != nil {
+		t.Error("Error expected")
+	}
+}
+
+func ExampleLex() {
+	tokens, err := milisp.Lex("(+ x 1) # comment\n")
+	if err != nil {
+		panic(err)
+	}
+	for _, t := range tokens {
+		fmt.Printf("%q\n", t)
+	}
+	// Output:
+	// "BEG:(@1:1"
+	// "SYM:+@1:2"
+	// "SPC: @1:3"
+	// "SYM:x@1:4"
+	// "SPC: @1:5"
+	// "NUM:1@1:6"
+	// "END:)@1:7"
+	// "SPC: @1:8"
+	// "CMT:# comment@1:9"
+	// "SPC:\n@1:18"
+}
+
+func ExampleParseSyntaxTree() {
+	tree, err := milisp.ParseSyntaxTree(`(vector
+    # UK
+    (in code UK) # Great Britain
+    (in code IL) # Israel
+)`)
+	if err != nil {
+		panic(err)
+	}
+	for _, n := range tree.Root.Children[1:] {
+		fmt.Printf("%s leading=%q trailing=%q\n", n.Expr, n.Leading, n.Trailing)
+	}
+	// rewrite tree: drop the second item with its comments
+	tree.Root.Children = tree.Root.Children[:2]
+	fmt.Println(tree)
+	// Output:
+	// [SYM:in@3:6 SYM:code@3:9 SYM:UK@3:14]@3:5 leading=["SPC:\n@1:8" "SPC:    @2:1" "CMT:# UK@2:5" "SPC:\n@2:9" "SPC:    @3:1"] trailing=["SPC: @3:17" "CMT:# Great Britain@3:18"]
+	// [SYM:in@4:6 SYM:code@4:9 SYM:IL@4:14]@4:5 leading=["SPC:\n@3:33" "SPC:    @4:1"] trailing=["SPC: @4:17" "CMT:# Israel@4:18"]
+	// (vector
+	//     # UK
+	//     (in code UK) # Great Britain
+	// )
+}
@@ -0,0 +1,286 @@
+package milisp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Position points to the place in the source text where node starts.
+// Column counts tab as 8 columns like terminals do, see Location for precise columns.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Location points to the place in the source text precisely.
+type Location struct {
+	Offset      int // in bytes, starting from 0
+	Line        int
+	Column      int // in runes, starting from 1
+	UTF16Column int // in UTF-16 code units, starting from 1, like LSP and JavaScript count
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%d:%d", l.Line, l.Column)
+}
+
+// Span is a range of the source text: from the first char of node to the char right after node.
+// Span is zero for nodes that are not obtained from source.
+type Span struct {
+	Source string // name of source, see WithSourceName
+	Start  Location
+	End    Location
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%s:%s-%s", s.Source, s.Start, s.End)
+}
+
+// where renders position of error with source name if it is known.
+func where(pos Position, span Span) string {
+	if span.Source == "" {
+		return pos.String()
+	}
+	return span.Source + ":" + pos.String()
+}
+
+// Symbol is a name that refers to the instance in environment.
+type Symbol struct {
+	name string
+	pos  Position
+	span Span
+}
+
+// NewSymbol creates symbol node. It is useful for generating and rewriting programs.
+func NewSymbol(name string, pos Position) *Symbol {
+	return &Symbol{name: name, pos: pos}
+}
+
+// Name of symbol as it appears in the source.
+func (s *Symbol) Name() string {
+	return s.name
+}
+
+// Position of symbol in the source.
+func (s *Symbol) Position() Position {
+	return s.pos
+}
+
+// Span of symbol in the source.
+func (s *Symbol) Span() Span {
+	return s.span
+}
+
+func (s *Symbol) String() string {
+	return fmt.Sprintf("SYM:%s@%s", s.name, s.pos)
+}
+
+// Eval looks up the symbol in environment and its parents, see NewScope.
+func (s *Symbol) Eval(env Environment) (interface{}, error) {
+	return s.eval(run{}, env)
+}
+
+func (s *Symbol) eval(r run, env Environment) (res interface{}, err error) {
+	if r.s == nil { // fast path of Eval
+		if err := r.enterPlain(s, false); err != nil {
+			return nil, err
+		}
+		return s.lookup(env)
+	}
+	v, _, err := r.enter(s, env, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { v.exit(res, err) }()
+	return s.lookup(env)
+}
+
+func (s *Symbol) lookup(env Environment) (interface{}, error) {
+	x, ok := env.Lookup(s.name)
+	if !ok {
+		return nil, &UnknownSymbolError{Name: s.name, Position: s.pos, Span: s.span}
+	}
+	return x, nil
+}
+
+// Number is a numeric constant.
+type Number struct {
+	value float64
+	text  string
+	pos   Position
+	span  Span
+}
+
+// NewNumber creates number node.
+func NewNumber(value float64, pos Position) *Number {
+	return &Number{value: value, text: formatFloat(value), pos: pos}
+}
+
+// formatFloat makes sure that the text is not parsed as integer.
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if _, ok, _ := parseInteger(s); ok {
+		s += ".0"
+	}
+	return s
+}
+
+// Value of constant.
+func (n *Number) Value() float64 {
+	return n.value
+}
+
+// Position of constant in the source.
+func (n *Number) Position() Position {
+	return n.pos
+}
+
+// Span of constant in the source.
+func (n *Number) Span() Span {
+	return n.span
+}
+
+func (n *Number) String() string {
+	return fmt.Sprintf("NUM:%s@%s", n.text, n.pos)
+}
+
+// Eval returns value of constant.
+func (n *Number) Eval(env Environment) (interface{}, error) {
+	return n.eval(run{}, env)
+}
+
+func (n *Number) eval(r run, _ Environment) (interface{}, error) {
+	return r.constant(n, n.value, nil)
+}
+
+// Integer is an exact integer constant. Literals without
+// fractional part and exponent are integers: 1, -2, 1_000_000, 0xff.
+type Integer struct {
+	value int64
+	text  string
+	pos   Position
+	span  Span
+}
+
+// NewInteger creates integer node.
+func NewInteger(value int64, pos Position) *Integer {
+	return &Integer{value: value, text: strconv.FormatInt(value, 10), pos: pos}
+}
+
+// Value of constant.
+func (n *Integer) Value() int64 {
+	return n.value
+}
+
+// Position of constant in the source.
+func (n *Integer) Position() Position {
+	return n.pos
+}
+
+// Span of constant in the source.
+func (n *Integer) Span() Span {
+	return n.span
+}
+
+func (n *Integer) String() string {
+	return fmt.Sprintf("INT:%s@%s", n.text, n.pos)
+}
+
+// Eval returns value of constant.
+func (n *Integer) Eval(env Environment) (interface{}, error) {
+	return n.eval(run{}, env)
+}
+
+func (n *Integer) eval(r run, _ Environment) (interface{}, error) {
+	return r.constant(n, n.value, nil)
+}
+
+// String is a string constant.
+type String struct {
+	value string
+	pos   Position
+	span  Span
+}
+
+// NewString creates string node.
+func NewString(value string, pos Position) *String {
+	return &String{value: value, pos: pos}
+}
+
+// Value of constant (unquoted and unescaped).
+func (s *String) Value() string {
+	return s.value
+}
+
+// Position of constant in the source.
+func (s *String) Position() Position {
+	return s.pos
+}
+
+// Span of constant in the source.
+func (s *String) Span() Span {
+	return s.span
+}
+
+func (s *String) String() string {
+	return fmt.Sprintf("STR:%s@%s", s.value, s.pos)
+}
+
+// Eval returns value of constant.
+func (s *String) Eval(env Environment) (interface{}, error) {
+	return s.eval(run{}, env)
+}
+
+func (s *String) eval(r run, _ Environment) (interface{}, error) {
+	return r.constant(s, s.value, nil)
+}
+
+// Literal is a constant recognized by custom LiteralFunc.
+type Literal struct {
+	value interface{}
+	text  string
+	pos   Position
+	span  Span
+}
+
+// NewLiteral creates literal node. The text have to be recognized back to the same value.
+func NewLiteral(value interface{}, text string, pos Position) *Literal {
+	return &Literal{value: value, text: text, pos: pos}
+}
+
+// Value of constant.
+func (n *Literal) Value() interface{} {
+	return n.value
+}
+
+// Text of constant as it appears in the source.
+func (n *Literal) Text() string {
+	return n.text
+}
+
+// Position of constant in the source.
+func (n *Literal) Position() Position {
+	return n.pos
+}
+
+// Span of constant in the source.
+func (n *Literal) Span() Span {
+	return n.span
+}
+
+func (n *Literal) String() string {
+	return fmt.Sprintf("LIT:%s@%s", n.text, n.pos)
+}
+
+// Eval returns value of constant.
+func (n *Literal) Eval(env Environment) (interface{}, error) {
+	return n.eval(run{}, env)
+}
+
+func (n *Literal) eval(r run, _ Environment) (interface{}, error) {
+	return r.constant(n, n.value, nil)
+}
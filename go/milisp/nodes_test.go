@@ -0,0 +1,77 @@
+package milisp_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+func describe(e milisp.Expression, indent string) {
+	switch n := e.(type) {
+	case *milisp.Symbol:
+		fmt.Printf("%ssymbol %s at %s\n", indent, n.Name(), n.Position())
+	case *milisp.Number:
+		fmt.Printf("%snumber %v at %s\n", indent, n.Value(), n.Position())
+	case *milisp.Integer:
+		fmt.Printf("%sinteger %v at %s\n", indent, n.Value(), n.Position())
+	case *milisp.String:
+		fmt.Printf("%sstring %q at %s\n", indent, n.Value(), n.Position())
+	case *milisp.List:
+		fmt.Printf("%slist of %d at %s\n", indent, len(n.Items()), n.Position())
+		for _, x := range n.Items() {
+			describe(x, indent+"  ")
+		}
+	}
+}
+
+func ExampleNode() {
+	expr, err := milisp.Compile(`(set x (f 1 1.5 "one"))`)
+	if err != nil {
+		panic(err)
+	}
+	describe(expr, "")
+	// Output:
+	// list of 3 at 1:1
+	//   symbol set at 1:2
+	//   symbol x at 1:6
+	//   list of 4 at 1:8
+	//     symbol f at 1:9
+	//     integer 1 at 1:11
+	//     number 1.5 at 1:13
+	//     string "one" at 1:17
+}
+
+func TestNode_Span(t *testing.T) {
+	text := "(f\t\"π\" 😀x\r\n  [1 {'a 2.5}]) #c\n#t"
+	prog, err := milisp.CompileProgram(text, milisp.WithSourceName("a.lisp"), milisp.WithLiteral("#", literalBool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := []string(nil)
+	milisp.Inspect(prog, func(e milisp.Expression) bool {
+		if n, ok := e.(milisp.Node); ok {
+			s := n.Span()
+			log = append(log, fmt.Sprintf("%q %s %s [%d:%d] utf16=%d-%d",
+				text[s.Start.Offset:s.End.Offset], n.Position(), s, s.Start.Offset, s.End.Offset,
+				s.Start.UTF16Column, s.End.UTF16Column))
+		}
+		return true
+	})
+	expected := []string{
+		`"(f\t\"π\" 😀x\r\n  [1 {'a 2.5}])" 1:1 a.lisp:1:1-2:16 [0:30] utf16=1-16`,
+		`"f" 1:2 a.lisp:1:2-1:3 [1:2] utf16=2-3`,
+		`"\"π\"" 1:9 a.lisp:1:4-1:7 [3:7] utf16=4-7`,
+		`"😀x" 1:13 a.lisp:1:8-1:10 [8:13] utf16=8-11`,
+		`"[1 {'a 2.5}]" 2:3 a.lisp:2:3-2:15 [17:29] utf16=3-15`,
+		`"1" 2:4 a.lisp:2:4-2:5 [18:19] utf16=4-5`,
+		`"{'a 2.5}" 2:6 a.lisp:2:6-2:14 [20:28] utf16=6-14`,
+		`"'a" 2:7 a.lisp:2:7-2:9 [21:23] utf16=7-9`,
+		`"2.5" 2:10 a.lisp:2:10-2:13 [24:27] utf16=10-13`,
+		`"#t" 3:1 a.lisp:3:1-3:3 [34:36] utf16=1-3`,
+	}
+	if strings.Join(log, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected spans:\n%s", strings.Join(log, "\n"))
+	}
+}
@@ -0,0 +1,80 @@
+package milisp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LiteralFunc recognizes custom literal. It gets the whole word (like symbol) including prefix.
+// It returns false if the word is not its literal. Error means that the word
+// is literal, however it is malformed.
+type LiteralFunc func(text string) (value interface{}, ok bool, err error)
+
+type literal struct {
+	prefix string
+	parse  LiteralFunc
+}
+
+type config struct {
+	literals      []literal
+	source        string
+	maxParseDepth int
+}
+
+// Option tunes compilation.
+type Option func(*config)
+
+// WithLiteral registers recognizer of custom literals that start with prefix.
+// Words are checked after numbers, but before symbols. Recognizers are checked in order of registration.
+//
+// Prefix is free to start with #: words like #t or #2024-01-01 are not comments anymore,
+// if they are recognized. All other words after # are still comments.
+func WithLiteral(prefix string, parse LiteralFunc) Option {
+	return func(c *config) {
+		c.literals = append(c.literals, literal{prefix: prefix, parse: parse})
+	}
+}
+
+// WithSourceName sets the name of source, usually file name. Spans of all nodes
+// and positions in error messages refer to it. It is useful when expressions from
+// several sources are merged into one program.
+func WithSourceName(name string) Option {
+	return func(c *config) {
+		c.source = name
+	}
+}
+
+// WithMaxParseDepth limits nesting of lists, vectors, maps, quotes and datum comments.
+// Compilation of deeper expression fails with *ParseDepthError. Parser itself doesn't use recursion,
+// however evaluation, printing and walking do, so it is wise to limit nesting of untrusted sources.
+// Zero or negative depth means no limit.
+func WithMaxParseDepth(depth int) Option {
+	return func(c *config) {
+		c.maxParseDepth = depth
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// literal tries all recognizers.
+func (c *config) literal(text string) (interface{}, bool, error) {
+	for _, l := range c.literals {
+		if !strings.HasPrefix(text, l.prefix) {
+			continue
+		}
+		v, ok, err := l.parse(text)
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid literal %s: %w", text, err)
+		}
+		if ok {
+			return v, true, nil
+		}
+	}
+	return nil, false, nil
+}
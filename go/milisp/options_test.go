@@ -0,0 +1,193 @@
+package milisp_test
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+func literalBool(text string) (interface{}, bool, error) {
+	switch text {
+	case "#t":
+		return true, true, nil
+	case "#f":
+		return false, true, nil
+	}
+	return nil, false, nil
+}
+
+func literalTime(text string) (interface{}, bool, error) {
+	t, err := time.Parse(time.RFC3339, text[1:])
+	if err != nil {
+		return nil, false, err
+	}
+	return t, true, nil
+}
+
+func literalDuration(text string) (interface{}, bool, error) {
+	if text == "" || text[0] < '0' || text[0] > '9' {
+		return nil, false, nil
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return nil, false, nil //nolint:nilerr // it is symbol, not duration
+	}
+	return d, true, nil
+}
+
+func TestWithLiteral(t *testing.T) {
+	opts := []milisp.Option{
+		milisp.WithLiteral("#", literalBool),
+		milisp.WithLiteral("@", literalTime),
+		milisp.WithLiteral("", literalDuration),
+	}
+	for _, c := range []struct {
+		text string
+		res  string
+	}{
+		{"#t", "[LIT:#t@1:1]"},
+		{"(f #t #f)", "[[SYM:f@1:2 LIT:#t@1:4 LIT:#f@1:7]@1:1]"},
+		{"(f #comment\n #f)", "[[SYM:f@1:2 LIT:#f@2:2]@1:1]"},
+		{"(f #x(y) z\n)#t", "[[SYM:f@1:2]@1:1 LIT:#t@2:2]"},
+		{"(f #t)#f", "[[SYM:f@1:2 LIT:#t@1:4]@1:1 LIT:#f@1:7]"},
+		{"(f #t\"x\" #t\n) #f", "[[SYM:f@1:2]@1:1 LIT:#f@2:3]"},
+		{"(f #\n)", "[[SYM:f@1:2]@1:1]"},
+		{"(f @2024-01-01T00:00:00Z 5m 5 x5m)", "[[SYM:f@1:2 LIT:@2024-01-01T00:00:00Z@1:4 LIT:5m@1:26 INT:5@1:29 SYM:x5m@1:31]@1:1]"},
+	} {
+		c := c
+		t.Run(c.text, func(t *testing.T) {
+			prog, err := milisp.CompileProgram(c.text, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(prog) != c.res {
+				t.Errorf("Unexpected result: %s", prog)
+			}
+			tree, err := milisp.Lex(c.text, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := strings.Builder{}
+			for _, x := range tree {
+				b.WriteString(x.Text)
+			}
+			if b.String() != c.text {
+				t.Errorf("Unexpected lossless result: %q", b.String())
+			}
+		})
+	}
+}
+
+func TestWithLiteral_error(t *testing.T) {
+	opts := []milisp.Option{milisp.WithLiteral("@", literalTime)}
+	_, err := milisp.Compile("(f @2024-13-01)", opts...)
+	var syntaxErr *milisp.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if syntaxErr.Position != (milisp.Position{Line: 1, Column: 4}) || syntaxErr.Token != "@2024-13-01" {
+		t.Errorf("Unexpected error: %#v", syntaxErr)
+	}
+	errs := milisp.Diagnose("(f @2024-13-01 @x)", opts...)
+	if len(errs) != 2 {
+		t.Errorf("Unexpected errors: %q", errs)
+	}
+}
+
+func ExampleWithLiteral() {
+	opts := []milisp.Option{
+		milisp.WithLiteral("#", literalBool),
+		milisp.WithLiteral("@", literalTime),
+		milisp.WithLiteral("", literalDuration),
+	}
+	expr, err := milisp.Compile(`(list
+		#t                     # true
+		#f                     # false
+		@2024-01-01T00:00:00Z  # timestamp
+		1h30m                  # duration
+	)`, opts...)
+	if err != nil {
+		panic(err)
+	}
+	env := milisp.Environment{
+		"list": milisp.OpFunc(func(env milisp.Environment, args []milisp.Expression) (interface{}, error) {
+			res := make([]interface{}, len(args))
+			for i, a := range args {
+				var err error
+				res[i], err = a.Eval(env)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return res, nil
+		}),
+	}
+	res, err := expr.Eval(env)
+	if err != nil {
+		panic(err)
+	}
+	for _, v := range res.([]interface{}) {
+		fmt.Printf("%T %v\n", v, v)
+	}
+	text, err := milisp.Format(expr)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(text)
+	// Output:
+	// bool true
+	// bool false
+	// time.Time 2024-01-01 00:00:00 +0000 UTC
+	// time.Duration 1h30m0s
+	// (list #t #f @2024-01-01T00:00:00Z 1h30m)
+}
+
+func TestWithMaxParseDepth(t *testing.T) {
+	deep := strings.Repeat("(", 100_000) + strings.Repeat(")", 100_000)
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20)) // parser doesn't use recursion, 1MB is enough
+	_, err := milisp.Compile(deep)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, c := range []struct {
+		text string
+		pos  milisp.Position
+	}{
+		{"(a (b [c {d e}]))", milisp.Position{}},
+		{"(a (b [c {d (e)}]))", milisp.Position{Line: 1, Column: 13}},
+		{"(a (b '''c))", milisp.Position{Line: 1, Column: 9}},
+		{"(a (b #;#;#;c d e f))", milisp.Position{Line: 1, Column: 11}},
+		{"(a (b \n  #;[(c d)] e))", milisp.Position{Line: 2, Column: 6}},
+		{deep, milisp.Position{Line: 1, Column: 5}},
+	} {
+		c := c
+		t.Run(fmt.Sprint(c.pos), func(t *testing.T) {
+			_, err := milisp.Compile(c.text, milisp.WithMaxParseDepth(4))
+			var target *milisp.ParseDepthError
+			if c.pos == (milisp.Position{}) {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &target) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if target.Limit != 4 || target.Position != c.pos {
+				t.Errorf("Unexpected error: %#v", target)
+			}
+		})
+	}
+}
+
+func TestWithMaxParseDepth_diagnose(t *testing.T) {
+	errs := milisp.Diagnose("(a b)\n(a (b (c)) (d))", milisp.WithMaxParseDepth(2))
+	if len(errs) != 1 || errs[0].Error() != "nesting depth exceeds 2 at 2:7" {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
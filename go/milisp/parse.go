@@ -2,38 +2,294 @@ package milisp
 
 import "fmt"
 
-func parse(tokens []universalToken, pos int) (Expression, int, bool, error) {
-	if pos >= len(tokens) {
-		return nil, 0, true, fmt.Errorf("unexpected end of file")
+// parser pulls tokens from lexer one by one, so it doesn't need the whole text.
+type parser struct {
+	lex        *lexer
+	token      universalToken // look-ahead token
+	ok         bool           // look-ahead token exists
+	ready      bool           // look-ahead is done
+	lexErr     error
+	recovering bool           // collect errors and go on instead of stop
+	errs       []*SyntaxError // errors collected in recovering mode
+}
+
+func newParser(lex *lexer) *parser {
+	return &parser{lex: lex}
+}
+
+// peek returns the next token without taking it. It returns false at the end of input.
+func (p *parser) peek() (universalToken, bool, error) {
+	if !p.ready {
+		t, ok, err := p.lex.next()
+		if err != nil {
+			p.lexErr = fmt.Errorf("tokenizer error: %w", err)
+			return universalToken{}, false, p.lexErr
+		}
+		p.token, p.ok, p.ready = t, ok, true
 	}
-	firstToken := tokens[pos]
-	switch firstToken.tp {
-	case tpOpen:
-		ee := []Expression(nil)
-		var e Expression
-		var err error
-		var finish bool
-		pos++
-		for {
-			e, pos, finish, err = parse(tokens, pos)
-			if err != nil {
-				return nil, 0, true, err
+	return p.token, p.ok, nil
+}
+
+// peekExpr is like peek, however it drops expressions commented out by #;.
+func (p *parser) peekExpr() (universalToken, bool, error) {
+	for {
+		t, ok, err := p.peek()
+		if err != nil || !ok || t.tp != tpDatumComment {
+			return t, ok, err
+		}
+		p.take()
+		_, _, err = p.run([]*frame{{open: t, span: t.span}})
+		if err != nil {
+			return universalToken{}, false, err
+		}
+	}
+}
+
+func (p *parser) take() {
+	p.ready = false
+}
+
+// wrap marks error as parser error. Tokenizer errors are already marked.
+func (p *parser) wrap(err error) error {
+	if p.lexErr != nil {
+		return p.lexErr
+	}
+	return fmt.Errorf("parser error: %w", err)
+}
+
+// program reads all top-level expressions.
+func (p *parser) program() (*Program, error) {
+	prog := &Program{}
+	for {
+		t, ok, err := p.peekExpr()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return prog, nil
+		}
+		expr, finish, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		if finish {
+			pos := Position{Line: t.line, Column: t.pos}
+			err := newSyntaxError(t.span, pos, t.str, "unexpected closing bracket %s at %s", t.str, where(pos, t.span))
+			if err := p.fail(err); err != nil {
+				return nil, err
 			}
-			if finish {
-				return expr{
-					expr: ee,
-					line: firstToken.line,
-					pos:  firstToken.pos,
-				}, pos + 1, false, nil
+			p.take()
+			continue
+		}
+		prog.exprs = append(prog.exprs, expr)
+	}
+}
+
+// frame is an unfinished list, vector, map, quote or datum comment.
+type frame struct {
+	open  universalToken // opening bracket, apostrophe or #;
+	items []Expression
+	span  Span
+}
+
+// parse reads one expression. It returns true if it meets closing bracket instead of expression.
+// Closing bracket is not taken in this case.
+func (p *parser) parse() (Expression, bool, error) {
+	return p.run(nil)
+}
+
+// run parses without recursion: unfinished expressions are kept in stack,
+// so deep nesting doesn't grow goroutine stack. If stack is not empty initially,
+// run stops as soon as the bottom frame is finished.
+func (p *parser) run(stack []*frame) (Expression, bool, error) {
+	base := len(stack)
+	for {
+		t, ok, err := p.peek()
+		if err != nil {
+			return nil, true, err
+		}
+		var e Expression // nil means closing bracket or end of input
+		switch {
+		case !ok || t.tp == tpClose:
+		case t.tp == tpOpen || t.tp == tpQuote || t.tp == tpDatumComment:
+			p.take()
+			if limit := p.lex.cfg.maxParseDepth; limit > 0 && len(stack) >= limit {
+				return nil, true, &ParseDepthError{Limit: limit, Position: Position{Line: t.line, Column: t.pos}, Span: t.span}
 			}
-			if pos >= len(tokens) {
-				return nil, 0, true, fmt.Errorf("unexpected end of file; can not end expr started at %s", firstToken)
+			stack = append(stack, &frame{open: t, span: t.span})
+			continue
+		default:
+			p.take()
+			e, err = t.node()
+			if err != nil {
+				return nil, true, err
 			}
-			ee = append(ee, e)
 		}
-	case tpClose:
-		return nil, pos, true, nil // pos will be shifted on call side
+		var done bool
+		stack, e, done, err = p.deliver(stack, base, e, t, ok)
+		if err != nil {
+			return nil, true, err
+		}
+		if done {
+			return e, e == nil, nil
+		}
+	}
+}
+
+// deliver passes expression (or closing bracket or end of input, if e is nil) to unfinished expressions.
+// It returns true if parsing is done.
+func (p *parser) deliver(
+	stack []*frame, base int, e Expression, t universalToken, ok bool,
+) ([]*frame, Expression, bool, error) {
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		if f.open.tp == tpOpen && e != nil {
+			f.items = append(f.items, e)
+			f.span.End = spanOf(e).End
+			return stack, nil, false, nil
+		}
+		stack = stack[:len(stack)-1]
+		commented := f.open.tp == tpDatumComment && e != nil
+		var err error
+		e, err = p.finish(f, e, t, ok)
+		if err != nil {
+			return nil, nil, true, err
+		}
+		if len(stack) < base {
+			return stack, e, true, nil
+		}
+		if commented {
+			return stack, nil, false, nil
+		}
+	}
+	if e == nil && !ok {
+		return nil, nil, true, newSyntaxError(Span{}, Position{}, "", "unexpected end of file")
+	}
+	return stack, e, true, nil
+}
+
+// finish turns frame into expression. It gets the last expression, or nil and closing bracket or end of input.
+// It returns nil for datum comment.
+func (p *parser) finish(f *frame, e Expression, t universalToken, ok bool) (Expression, error) {
+	switch f.open.tp {
+	case tpOpen:
+		return p.compound(f, t, ok)
+	case tpQuote:
+		return p.quote(f, e)
+	default: // case tpDatumComment:
+		if e != nil {
+			return nil, nil // dropped
+		}
+		t := f.open
+		pos := Position{Line: t.line, Column: t.pos}
+		return nil, p.fail(newSyntaxError(t.span, pos, t.str, "nothing to comment out by #; at %s", where(pos, t.span)))
+	}
+}
+
+// fail returns error or collects it in recovering mode.
+func (p *parser) fail(err *SyntaxError) error {
+	if !p.recovering {
+		return err
+	}
+	p.errs = append(p.errs, err)
+	return nil
+}
+
+// closingBracket maps opening brackets to closing ones.
+func closingBracket(open string) string {
+	switch open {
+	case "[":
+		return "]"
+	case "{":
+		return "}"
+	default: // case "(":
+		return ")"
+	}
+}
+
+// compound finishes items by closing bracket t or by the end of input.
+func (p *parser) compound(f *frame, t universalToken, ok bool) (Expression, error) {
+	open := f.open
+	pos := Position{Line: open.line, Column: open.pos}
+	if !ok {
+		err := newSyntaxError(open.span, pos, open.str, "unclosed bracket %s at %s", open.str, where(pos, open.span))
+		if err := p.fail(err); err != nil {
+			return nil, err
+		}
+		return p.node(open.str, f.items, pos, f.span) // consider list closed
+	}
+	p.take()
+	f.span.End = t.span.End
+	if t.str != closingBracket(open.str) {
+		closePos := Position{Line: t.line, Column: t.pos}
+		err := newSyntaxError(
+			t.span, closePos, t.str, "closing bracket %s at %s does not match %s at %s",
+			t.str, where(closePos, t.span), open.str, where(pos, open.span))
+		if err := p.fail(err); err != nil {
+			return nil, err
+		}
+		// consider it matching
+	}
+	return p.node(open.str, f.items, pos, f.span)
+}
+
+// node creates list, vector or map node depending on bracket.
+func (p *parser) node(open string, items []Expression, pos Position, span Span) (Expression, error) {
+	switch open {
+	case "[":
+		return &Vector{items: items, pos: pos, span: span}, nil
+	case "{":
+		if len(items)%2 != 0 {
+			err := newSyntaxError(span, pos, open, "map at %s has key without value", where(pos, span))
+			if err := p.fail(err); err != nil {
+				return nil, err
+			}
+			items = items[:len(items)-1]
+		}
+		return &Map{items: items, pos: pos, span: span}, nil
 	default:
-		return firstToken, pos + 1, false, nil
+		return p.list(items, pos, span)
+	}
+}
+
+// quote finishes quoted expression e. If e is nil, there is nothing to quote.
+func (p *parser) quote(f *frame, e Expression) (Expression, error) {
+	apostrophe := f.open
+	pos := Position{Line: apostrophe.line, Column: apostrophe.pos}
+	span := apostrophe.span
+	if e == nil {
+		err := newSyntaxError(span, pos, apostrophe.str, "nothing to quote by ' at %s", where(pos, span))
+		if err := p.fail(err); err != nil {
+			return nil, err
+		}
+		e = &List{pos: pos, span: span}
+	}
+	span.End = spanOf(e).End
+	return &Quote{datum: e, pos: pos, span: span}, nil
+}
+
+// list creates list node. Special form (quote x) turns into quote node.
+func (p *parser) list(items []Expression, pos Position, span Span) (Expression, error) {
+	if len(items) == 0 {
+		return &List{items: items, pos: pos, span: span}, nil
+	}
+	if s, ok := items[0].(*Symbol); !ok || s.name != "quote" {
+		return &List{items: items, pos: pos, span: span}, nil
+	}
+	if len(items) != 2 {
+		err := newSyntaxError(span, pos, "(", "quote expects exactly one expression at %s", where(pos, span))
+		if err := p.fail(err); err != nil {
+			return nil, err
+		}
+		return &List{items: items, pos: pos, span: span}, nil
+	}
+	return &Quote{datum: items[1], pos: pos, span: span}, nil
+}
+
+// spanOf returns span of node, or zero span for other expressions.
+func spanOf(e Expression) Span {
+	if n, ok := e.(Node); ok {
+		return n.Span()
 	}
+	return Span{}
 }
@@ -0,0 +1,280 @@
+package milisp
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ProfileEntry is aggregated cost of operation calls. Total cost includes nested lists,
+// self cost excludes them. Allocations are measured only if Profiler.Allocs is set, they are approximate.
+type ProfileEntry struct {
+	Op         string // the first item of list, usually the name of operation
+	Position   Position
+	Span       Span
+	Calls      int64
+	Total      time.Duration
+	Self       time.Duration
+	Bytes      uint64 // allocated bytes, total, approximate
+	Allocs     uint64 // number of allocations, total, approximate
+	SelfBytes  uint64
+	SelfAllocs uint64
+}
+
+// Profiler aggregates cost of operations across many evaluations, by operation and by source position.
+// Profiler is safe for concurrent use, operations may evaluate arguments in goroutines too: cost of
+// list is attributed to the list that has called it, self time of list which nested lists run
+// concurrently is wall time minus their total time, but not less than zero. Every evaluation needs its own tracer:
+//
+//	res, err := milisp.EvalContext(ctx, env, expr, milisp.WithTracer(profiler.Tracer()))
+//
+// Zero value is ready to use.
+type Profiler struct {
+	// Allocs turns on approximate measuring of allocations. Counters of runtime.ReadMemStats are process-wide,
+	// so list gets allocations of everything that runs meanwhile: other evaluations, goroutines of operations,
+	// profiler itself. Turn it on to profile one evaluation at a time, when nothing else runs.
+	// It is expensive too: runtime.ReadMemStats stops the world twice per list.
+	Allocs bool
+
+	mu          sync.Mutex
+	byOperation map[string]*ProfileEntry
+	byPosition  map[profileKey]*ProfileEntry
+}
+
+type profileKey struct {
+	op     string
+	source string
+	pos    Position
+}
+
+// Tracer returns tracer for one evaluation.
+func (p *Profiler) Tracer() Tracer {
+	return &profileTracer{profiler: p}
+}
+
+// Reset drops collected data.
+func (p *Profiler) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.byOperation = nil
+	p.byPosition = nil
+}
+
+// ByOperation returns cost of every operation, the most expensive (by self time) first.
+// Position and Span are not set.
+func (p *Profiler) ByOperation() []ProfileEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make([]ProfileEntry, 0, len(p.byOperation))
+	for _, e := range p.byOperation {
+		res = append(res, *e)
+	}
+	sortProfile(res)
+	return res
+}
+
+// ByPosition returns cost of every list of source, the most expensive (by self time) first.
+func (p *Profiler) ByPosition() []ProfileEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make([]ProfileEntry, 0, len(p.byPosition))
+	for _, e := range p.byPosition {
+		res = append(res, *e)
+	}
+	sortProfile(res)
+	return res
+}
+
+func sortProfile(ee []ProfileEntry) {
+	sort.Slice(ee, func(i, j int) bool {
+		a, b := ee[i], ee[j]
+		if a.Self != b.Self {
+			return a.Self > b.Self
+		}
+		if a.Op != b.Op {
+			return a.Op < b.Op
+		}
+		if a.Span.Source != b.Span.Source {
+			return a.Span.Source < b.Span.Source
+		}
+		p, q := a.Position, b.Position
+		return p.Line < q.Line || p.Line == q.Line && p.Column < q.Column
+	})
+}
+
+// WriteReport writes text report: tables by operation and by position.
+func (p *Profiler) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := "calls\ttotal\tself\t"
+	if p.Allocs {
+		header += "~bytes\t~allocs\t~self bytes\t~self allocs\t" // approximate
+	}
+	_, err := fmt.Fprintf(tw, "%s\toperation\n", header)
+	if err != nil {
+		return err
+	}
+	for _, e := range p.ByOperation() {
+		_, err = fmt.Fprintf(tw, "%s\t%s\n", p.reportLine(e), e.Op)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(tw, "\t\t\t\n%s\toperation at\n", header)
+	if err != nil {
+		return err
+	}
+	for _, e := range p.ByPosition() {
+		_, err = fmt.Fprintf(tw, "%s\t%s at %s\n", p.reportLine(e), e.Op, where(e.Position, e.Span))
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+func (p *Profiler) reportLine(e ProfileEntry) string {
+	s := fmt.Sprintf("%d\t%s\t%s\t", e.Calls, e.Total, e.Self)
+	if p.Allocs {
+		s += fmt.Sprintf("%d\t%d\t%d\t%d\t", e.Bytes, e.Allocs, e.SelfBytes, e.SelfAllocs)
+	}
+	return s
+}
+
+func (p *Profiler) add(list *List, total, self time.Duration, allocs, selfAllocs profileAllocs) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.byOperation == nil {
+		p.byOperation = map[string]*ProfileEntry{}
+		p.byPosition = map[profileKey]*ProfileEntry{}
+	}
+	op := operationName(list.items[0])
+	e, ok := p.byOperation[op]
+	if !ok {
+		e = &ProfileEntry{Op: op}
+		p.byOperation[op] = e
+	}
+	e.add(total, self, allocs, selfAllocs)
+	k := profileKey{op: op, source: list.span.Source, pos: list.pos}
+	e, ok = p.byPosition[k]
+	if !ok {
+		e = &ProfileEntry{Op: op, Position: list.pos, Span: list.span}
+		p.byPosition[k] = e
+	}
+	e.add(total, self, allocs, selfAllocs)
+}
+
+func (e *ProfileEntry) add(total, self time.Duration, allocs, selfAllocs profileAllocs) {
+	e.Calls++
+	e.Total += total
+	e.Self += self
+	e.Bytes += allocs.bytes
+	e.Allocs += allocs.count
+	e.SelfBytes += selfAllocs.bytes
+	e.SelfAllocs += selfAllocs.count
+}
+
+type profileAllocs struct {
+	bytes uint64
+	count uint64
+}
+
+// sub subtracts b, it saturates at zero: counters are approximate.
+func (a profileAllocs) sub(b profileAllocs) profileAllocs {
+	res := profileAllocs{}
+	if a.bytes > b.bytes {
+		res.bytes = a.bytes - b.bytes
+	}
+	if a.count > b.count {
+		res.count = a.count - b.count
+	}
+	return res
+}
+
+func (a profileAllocs) add(b profileAllocs) profileAllocs {
+	return profileAllocs{bytes: a.bytes + b.bytes, count: a.count + b.count}
+}
+
+// profileFrame is a list in progress.
+type profileFrame struct {
+	list   *List
+	parent *profileFrame
+	allocs profileAllocs // at entry
+
+	mu          sync.Mutex // nested lists can exit concurrently
+	child       time.Duration
+	childAllocs profileAllocs
+}
+
+// profileTracer collects costs of one evaluation. Evaluation passes frames along every chain
+// of nested lists, so lists that operations evaluate in goroutines are attributed to their callers,
+// see frameTracer. Stack is used only if Enter and Exit are called directly.
+type profileTracer struct {
+	profiler *Profiler
+	mu       sync.Mutex
+	stack    []interface{}
+}
+
+func (t *profileTracer) Enter(n Node) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var parent interface{}
+	if len(t.stack) > 0 {
+		parent = t.stack[len(t.stack)-1]
+	}
+	t.stack = append(t.stack, t.enterFrame(n, parent))
+}
+
+func (t *profileTracer) Exit(n Node, _ interface{}, _ error, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.stack) == 0 {
+		return
+	}
+	frame := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+	t.exitFrame(n, frame, d)
+}
+
+func (t *profileTracer) enterFrame(n Node, parent interface{}) interface{} {
+	list, ok := n.(*List)
+	if !ok || len(list.items) == 0 {
+		return parent
+	}
+	p, _ := parent.(*profileFrame)
+	return &profileFrame{list: list, parent: p, allocs: t.readAllocs()}
+}
+
+func (t *profileTracer) exitFrame(n Node, frame interface{}, d time.Duration) {
+	f, _ := frame.(*profileFrame)
+	if f == nil || f.list != n {
+		return
+	}
+	allocs := t.readAllocs().sub(f.allocs)
+	if p := f.parent; p != nil {
+		p.mu.Lock()
+		p.child += d
+		p.childAllocs = p.childAllocs.add(allocs)
+		p.mu.Unlock()
+	}
+	f.mu.Lock()
+	child, childAllocs := f.child, f.childAllocs
+	f.mu.Unlock()
+	self := d - child
+	if self < 0 { // nested lists run concurrently
+		self = 0
+	}
+	t.profiler.add(f.list, d, self, allocs, allocs.sub(childAllocs))
+}
+
+func (t *profileTracer) readAllocs() profileAllocs {
+	if !t.profiler.Allocs {
+		return profileAllocs{}
+	}
+	mem := runtime.MemStats{}
+	runtime.ReadMemStats(&mem)
+	return profileAllocs{bytes: mem.TotalAlloc, count: mem.Mallocs}
+}
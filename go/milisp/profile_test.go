@@ -0,0 +1,176 @@
+package milisp_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+func factorialEnv() milisp.Environment {
+	return milisp.Environment{
+		"prog":      milisp.ContextOpFunc(evalAllReturnLastResult),
+		"def":       milisp.OpFunc(functionDefinition),
+		"call":      milisp.ContextOpFunc(functionCall),
+		"if_gt_one": milisp.ContextOpFunc(ifGtOne),
+		"*":         milisp.ContextOpFunc(mulAll),
+		"+":         milisp.ContextOpFunc(sumAll),
+		"N":         5.,
+	}
+}
+
+const factorialText = `
+(prog
+    (def F x (if_gt_one x
+        (* x (call F (+ x -1)))
+        1))
+    (call F N))`
+
+func TestProfiler(t *testing.T) {
+	expr, err := milisp.Compile(factorialText, milisp.WithSourceName("f.lisp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &milisp.Profiler{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := milisp.EvalContext(context.Background(), factorialEnv(), expr, milisp.WithTracer(p.Tracer()))
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	calls := map[string]int64{}
+	for _, e := range p.ByOperation() {
+		calls[e.Op] = e.Calls
+		if e.Self > e.Total || e.Bytes != 0 || e.Allocs != 0 {
+			t.Errorf("Self cost is greater than total: %#v", e)
+		}
+		if e.Position != (milisp.Position{}) {
+			t.Errorf("Unexpected position: %#v", e)
+		}
+	}
+	expected := map[string]int64{"prog": 4, "def": 4, "call": 4 * 5, "if_gt_one": 4 * 5, "*": 4 * 4, "+": 4 * 4}
+	if len(calls) != len(expected) {
+		t.Errorf("Unexpected calls: %v", calls)
+	}
+	for k, v := range expected {
+		if calls[k] != v {
+			t.Errorf("Unexpected calls of %s: %d", k, calls[k])
+		}
+	}
+	positions := map[string]int64{}
+	for _, e := range p.ByPosition() {
+		positions[e.Op+" at "+e.Position.String()] = e.Calls
+		if e.Span.Source != "f.lisp" {
+			t.Errorf("Unexpected span: %#v", e)
+		}
+	}
+	if positions["call at 4:14"] != 16 || positions["call at 6:5"] != 4 || len(positions) != 7 {
+		t.Errorf("Unexpected calls: %v", positions)
+	}
+	b := strings.Builder{}
+	err = p.WriteReport(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := b.String()
+	for _, s := range []string{"self  operation\n", "self  operation at\n", "  if_gt_one\n", "  call at f.lisp:6:5\n"} {
+		if !strings.Contains(report, s) {
+			t.Errorf("%q not found in report:\n%s", s, report)
+		}
+	}
+	p.Reset()
+	if len(p.ByOperation()) != 0 || len(p.ByPosition()) != 0 {
+		t.Errorf("Profiler is not reset")
+	}
+}
+
+// TestProfiler_goroutines is meaningful with race detector: go test -race.
+func TestProfiler_goroutines(t *testing.T) {
+	env := milisp.Environment{
+		"par": milisp.ContextOpFunc(opPar),
+		"P":   milisp.ContextOpFunc(evalAllReturnLastResult),
+		"sleep": milisp.OpFunc(func(_ milisp.Environment, _ []milisp.Expression) (interface{}, error) {
+			time.Sleep(10 * time.Millisecond)
+			return nil, nil
+		}),
+	}
+	expr, err := milisp.Compile("(P (par (P (sleep)) (P (sleep)) (P (sleep)) (P (sleep))))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &milisp.Profiler{}
+	_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithTracer(p.Tracer()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string]milisp.ProfileEntry{}
+	for _, e := range p.ByPosition() {
+		entries[e.Op+" at "+e.Position.String()] = e
+		if e.Self < 0 || e.Self > e.Total {
+			t.Errorf("Unexpected self time: %#v", e)
+		}
+	}
+	if len(entries) != 10 || entries["sleep at 1:12"].Calls != 1 || entries["P at 1:9"].Calls != 1 {
+		t.Fatalf("Unexpected entries: %v", entries)
+	}
+	// every goroutine is attributed to its own chain: nested lists are not attributed to par
+	for _, k := range []string{"P at 1:1", "P at 1:9", "P at 1:21", "P at 1:33", "P at 1:45"} {
+		if e := entries[k]; e.Self >= 10*time.Millisecond || e.Total < 10*time.Millisecond {
+			t.Errorf("Unexpected cost of %s: %#v", k, e)
+		}
+	}
+	if e := entries["par at 1:4"]; e.Self >= 10*time.Millisecond {
+		t.Errorf("Unexpected cost of par: %#v", e)
+	}
+}
+
+// TestProfiler_allocs runs one evaluation at a time, allocations are process-wide.
+func TestProfiler_allocs(t *testing.T) {
+	const size = 1 << 20
+	env := milisp.Environment{
+		"P": milisp.ContextOpFunc(evalAllReturnLastResult),
+		"alloc": milisp.OpFunc(func(_ milisp.Environment, _ []milisp.Expression) (interface{}, error) {
+			return make([]byte, size), nil
+		}),
+	}
+	expr, err := milisp.Compile("(P (alloc) (alloc))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &milisp.Profiler{Allocs: true}
+	_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithTracer(p.Tracer()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string]milisp.ProfileEntry{}
+	for _, e := range p.ByOperation() {
+		entries[e.Op] = e
+		if e.SelfBytes > e.Bytes || e.SelfAllocs > e.Allocs {
+			t.Errorf("Self cost is greater than total: %#v", e)
+		}
+	}
+	alloc, prog := entries["alloc"], entries["P"]
+	if alloc.Calls != 2 || alloc.SelfBytes < 2*size || alloc.SelfAllocs < 2 {
+		t.Errorf("Unexpected allocations: %#v", alloc)
+	}
+	if prog.Bytes < alloc.Bytes || prog.Allocs < alloc.Allocs {
+		t.Errorf("Total allocations don't include nested ones: %#v", prog)
+	}
+	b := strings.Builder{}
+	err = p.WriteReport(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "~self allocs  operation\n") {
+		t.Errorf("Unexpected report:\n%s", b.String())
+	}
+}
@@ -1,19 +1,145 @@
 package milisp
 
-import "fmt"
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
 
 // Compile text of lisp program to ready to run internal representation.
-func Compile(text string) (Expression, error) {
-	tokens, err := tokenize(text)
+func Compile(text string, opts ...Option) (Expression, error) {
+	return compile(strings.NewReader(text), newConfig(opts))
+}
+
+// CompileReader is like Compile, however it reads source from r incrementally.
+func CompileReader(r io.Reader, opts ...Option) (Expression, error) {
+	return compile(runeReader(r), newConfig(opts))
+}
+
+func runeReader(r io.Reader) io.RuneReader {
+	if rr, ok := r.(io.RuneReader); ok {
+		return rr
+	}
+	return bufio.NewReader(r)
+}
+
+func compile(r io.RuneReader, cfg *config) (Expression, error) {
+	p := newParser(newLexer(r, cfg))
+	expr, _, err := p.parse() // we can drop finish-flag, err is enough
 	if err != nil {
-		return nil, fmt.Errorf("tokenizer error: %s", err)
+		return nil, p.wrap(err)
 	}
-	expr, pos, _, err := parse(tokens, 0) // we can drop finish-flag, err is enough
+	t, ok, err := p.peekExpr()
 	if err != nil {
-		return nil, fmt.Errorf("parser error: %s", err)
+		return nil, p.wrap(err)
 	}
-	if pos < len(tokens) {
-		return nil, fmt.Errorf("extra content after token %s", tokens[pos])
+	if ok {
+		return nil, newSyntaxError(t.span, Position{Line: t.line, Column: t.pos}, t.str, "extra content after token %s", t)
 	}
 	return expr, nil
 }
+
+// Program is a sequence of top-level expressions.
+// Program is an Expression itself: it evaluates all expressions in order and returns the last result.
+type Program struct {
+	exprs []Expression
+}
+
+// CompileProgram compiles text that consists of any number of top-level expressions.
+func CompileProgram(text string, opts ...Option) (*Program, error) {
+	return compileProgram(strings.NewReader(text), newConfig(opts))
+}
+
+// CompileProgramReader is like CompileProgram, however it reads source from r incrementally.
+func CompileProgramReader(r io.Reader, opts ...Option) (*Program, error) {
+	return compileProgram(runeReader(r), newConfig(opts))
+}
+
+func compileProgram(r io.RuneReader, cfg *config) (*Program, error) {
+	p := newParser(newLexer(r, cfg))
+	prog, err := p.program()
+	if err != nil {
+		return nil, p.wrap(err)
+	}
+	return prog, nil
+}
+
+// Diagnose compiles program like CompileProgram does, however it doesn't stop
+// at the first problem. It skips unexpected chars and closing brackets,
+// closes all unclosed lists at the end of text and goes on.
+// It returns all syntax errors ordered by position or nil if text is correct.
+func Diagnose(text string, opts ...Option) []*SyntaxError {
+	lex := newLexer(strings.NewReader(text), newConfig(opts))
+	lex.recovering = true
+	p := newParser(lex)
+	p.recovering = true
+	_, err := p.program()
+	errs := make([]*SyntaxError, 0, len(lex.errs)+len(p.errs))
+	errs = append(errs, lex.errs...)
+	errs = append(errs, p.errs...)
+	var (
+		syntaxErr *SyntaxError
+		depthErr  *ParseDepthError
+	)
+	if errors.As(err, &syntaxErr) { // impossible, however we don't want to lose anything
+		errs = append(errs, syntaxErr)
+	}
+	if errors.As(err, &depthErr) { // parser gives up
+		err := newSyntaxError(depthErr.Span, depthErr.Position, "", "%s", depthErr)
+		err.Err = depthErr
+		errs = append(errs, err)
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := errs[i].Position, errs[j].Position
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return errs
+}
+
+// NewProgram creates program from expressions.
+func NewProgram(exprs []Expression) *Program {
+	return &Program{exprs: exprs}
+}
+
+// Expressions returns top-level expressions of program.
+func (p *Program) Expressions() []Expression {
+	return p.exprs
+}
+
+func (p *Program) String() string {
+	return fmt.Sprint(p.exprs)
+}
+
+// Eval evaluates all expressions in order and returns result of the last one.
+// Empty program returns nil.
+func (p *Program) Eval(env Environment) (interface{}, error) {
+	return p.eval(run{}, env)
+}
+
+func (p *Program) eval(r run, env Environment) (interface{}, error) {
+	res := interface{}(nil)
+	for _, e := range p.exprs {
+		var err error
+		res, err = evalIn(r, env, e)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// EvalAll evaluates all expressions in order and returns all results.
+func (p *Program) EvalAll(env Environment) ([]interface{}, error) {
+	res := make([]interface{}, len(p.exprs))
+	for i, e := range p.exprs {
+		var err error
+		res[i], err = e.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
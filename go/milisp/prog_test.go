@@ -1,7 +1,12 @@
 package milisp_test
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
 
 	"github.com/michurin/milisp/go/milisp"
 )
@@ -13,6 +18,10 @@ func ExampleCompile_validSyntax() {
 		"(A)",
 		"(A(X Y)A)",
 		"((X Y))",
+		"(A #;(X Y) B)",
+		"(A #; #; X Y B)",
+		"#;(X) A #;Y",
+		"(A #| (X Y)\n |# B)",
 	} {
 		expr, err := milisp.Compile(text)
 		if err != nil {
@@ -26,6 +35,10 @@ func ExampleCompile_validSyntax() {
 	// [SYM:A@1:2]@1:1
 	// [SYM:A@1:2 [SYM:X@1:4 SYM:Y@1:6]@1:3 SYM:A@1:8]@1:1
 	// [[SYM:X@1:3 SYM:Y@1:5]@1:2]@1:1
+	// [SYM:A@1:2 SYM:B@1:12]@1:1
+	// [SYM:A@1:2 SYM:B@1:14]@1:1
+	// SYM:A@1:7
+	// [SYM:A@1:2 SYM:B@2:5]@1:1
 }
 
 func ExampleCompile_invalidSyntax() {
@@ -34,6 +47,12 @@ func ExampleCompile_invalidSyntax() {
 		"\\",
 		"(",
 		"(()",
+		"(A #;)",
+		"A #;",
+		"A #|",
+		"(A]",
+		"{A}",
+		"[A",
 	} {
 		expr, err := milisp.Compile(text)
 		if err == nil || expr != nil {
@@ -44,6 +63,201 @@ func ExampleCompile_invalidSyntax() {
 	// Output:
 	// extra content after token SYM:B@1:3
 	// tokenizer error: unexpected char \ at 1:1
-	// parser error: unexpected end of file
-	// parser error: unexpected end of file; can not end expr started at BEG:(@1:1
+	// parser error: unclosed bracket ( at 1:1
+	// parser error: unclosed bracket ( at 1:1
+	// parser error: nothing to comment out by #; at 1:4
+	// parser error: nothing to comment out by #; at 1:3
+	// tokenizer error: unterminated block comment started at 1:3
+	// parser error: closing bracket ] at 1:3 does not match ( at 1:1
+	// parser error: map at 1:1 has key without value
+	// parser error: unclosed bracket [ at 1:1
+}
+
+func ExampleCompileProgram() {
+	// init and calculate scripts can live in one file
+	prog, err := milisp.CompileProgram(`
+	(set_str_list "UK" "+44")
+	(set_str_list "IL" "+972")
+	(vector (in phoneCountryCode UK) (in phoneCountryCode IL))
+	`)
+	if err != nil {
+		panic(err)
+	}
+	env := milisp.Environment{
+		"vector":       milisp.OpFunc(opVector),
+		"in":           milisp.OpFunc(opIn),
+		"set_str_list": milisp.OpFunc(opSetStringList),
+		// data
+		"phoneCountryCode": "+972",
+	}
+	fmt.Println(len(prog.Expressions()))
+	res, err := prog.EvalAll(env)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(res)
+	// Output:
+	// 3
+	// [<nil> <nil> [0 1]]
+}
+
+func ExampleCompileProgram_invalidSyntax() {
+	for _, text := range []string{
+		"A )",
+		"\\",
+		"A (",
+	} {
+		prog, err := milisp.CompileProgram(text)
+		if err == nil || prog != nil {
+			panic(text)
+		}
+		fmt.Println(err)
+	}
+	// Output:
+	// parser error: unexpected closing bracket ) at 1:3
+	// tokenizer error: unexpected char \ at 1:1
+	// parser error: unclosed bracket ( at 1:3
+}
+
+func TestProgram_Eval(t *testing.T) {
+	prog, err := milisp.CompileProgram("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := prog.Eval(milisp.Environment{})
+	if res != nil || err != nil {
+		t.Errorf("Unexpected result: %v %v", res, err)
+	}
+	prog, err = milisp.CompileProgram("A B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = prog.Eval(milisp.Environment{"A": 1, "B": 2})
+	if res != 2 || err != nil {
+		t.Errorf("Unexpected result: %v %v", res, err)
+	}
+	res, err = prog.Eval(milisp.Environment{"B": 2})
+	if res != nil || err == nil {
+		t.Errorf("Unexpected result: %v %v", res, err)
+	}
+	all, err := prog.EvalAll(milisp.Environment{"A": 1})
+	if all != nil || err == nil {
+		t.Errorf("Unexpected result: %v %v", all, err)
+	}
+	text, err := milisp.Format(prog)
+	if text != "A\nB" || err != nil {
+		t.Errorf("Unexpected result: %q %v", text, err)
+	}
+}
+
+func TestCompileReader(t *testing.T) {
+	text := "(f\n  \"ж\" # comment\n  (g x\x1by) 1)"
+	expr, err := milisp.CompileReader(iotest.OneByteReader(strings.NewReader(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(expr) != "[SYM:f@1:2 STR:ж@2:3 [SYM:g@3:4 SYM:x\x1by@3:6]@3:3 INT:1@3:11]@1:1" {
+		t.Errorf("Unexpected result: %s", expr)
+	}
+	errRead := errors.New("read error")
+	for _, r := range []io.Reader{
+		iotest.ErrReader(errRead),
+		io.MultiReader(strings.NewReader("(f x"), iotest.ErrReader(errRead)),
+	} {
+		expr, err := milisp.CompileReader(r)
+		if expr != nil || !errors.Is(err, errRead) {
+			t.Errorf("Unexpected result: %v %v", expr, err)
+		}
+	}
+	for _, text := range []string{"(f))", "(f", `"`} {
+		expr, err := milisp.CompileReader(strings.NewReader(text))
+		if expr != nil || err == nil {
+			t.Errorf("Unexpected result: %v %v", expr, err)
+		}
+	}
+}
+
+func TestCompileProgramReader(t *testing.T) {
+	b := strings.Builder{}
+	for i := 0; i < 10000; i++ {
+		b.WriteString("(f x 1)\n")
+	}
+	prog, err := milisp.CompileProgramReader(iotest.HalfReader(strings.NewReader(b.String())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exprs := prog.Expressions()
+	if len(exprs) != 10000 || fmt.Sprint(exprs[9999]) != "[SYM:f@10000:2 SYM:x@10000:4 INT:1@10000:6]@10000:1" {
+		t.Errorf("Unexpected result: %d %s", len(exprs), exprs[len(exprs)-1])
+	}
+	prog, err = milisp.CompileProgramReader(strings.NewReader("(f) \\"))
+	if prog != nil || err == nil {
+		t.Errorf("Unexpected result: %v %v", prog, err)
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		errs []string
+	}{
+		{"", nil},
+		{"(a b) c", nil},
+		{"a)", []string{"unexpected closing bracket ) at 1:2"}},
+		{"(a\n  (b\n (c)", []string{"unclosed bracket ( at 1:1", "unclosed bracket ( at 2:3"}},
+		{"(a #;) #; #;", []string{
+			"nothing to comment out by #; at 1:4",
+			"nothing to comment out by #; at 1:8",
+			"nothing to comment out by #; at 1:11",
+		}},
+		{"(a] {b} [c}} d}", []string{
+			"closing bracket ] at 1:3 does not match ( at 1:1",
+			"map at 1:5 has key without value",
+			"closing bracket } at 1:11 does not match [ at 1:9",
+			"unexpected closing bracket } at 1:12",
+			"unexpected closing bracket } at 1:15",
+		}},
+		{"(a #;(b) #| c", []string{"unclosed bracket ( at 1:1", "unterminated block comment started at 1:10"}},
+		{`"\q \u12" \uD800 "\U1234567Z"`, []string{
+			`unknown escape sequence \q at 1:2`,
+			`invalid escape sequence \u12" at 1:5`,
+			`unexpected char \ at 1:11`,
+			`invalid escape sequence \U1234567Z at 1:19`,
+		}},
+		{`(a b"c d#e) \ (f "g`, []string{
+			`unexpected char " in symbol at 1:5`,
+			"unexpected char # in symbol at 1:9",
+			`unexpected char \ at 1:13`,
+			"unclosed bracket ( at 1:15",
+			"unterminated string started at 1:18",
+		}},
+	} {
+		c := c
+		t.Run(c.text, func(t *testing.T) {
+			errs := milisp.Diagnose(c.text)
+			if len(errs) != len(c.errs) {
+				t.Fatalf("Unexpected errors: %q", errs)
+			}
+			for i, err := range errs {
+				if err.Error() != c.errs[i] {
+					t.Errorf("Unexpected error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func ExampleDiagnose() {
+	for _, err := range milisp.Diagnose(`
+	(vector
+	    (and (in phoneCountryCode UK) (in phoneAreaCode LDN)
+	    (and (in phoneCountryCode IL) (in phone"AreaCode TLV))
+	    (and (in phoneCountryCode RU) (in phoneAreaCode MSK)))
+	\`) {
+		fmt.Println(err.Position, err)
+	}
+	// Output:
+	// 2:9 unclosed bracket ( at 2:9
+	// 4:52 unexpected char " in symbol at 4:52
+	// 6:9 unexpected char \ at 6:9
 }
@@ -0,0 +1,142 @@
+package milisp
+
+// ParentKey is the reserved name of the link to parent scope (Environment or *Base), see NewScope
+// and Base.Overlay. Symbol can not contain space, and methods of Environment never read or write
+// it as variable, so operations that take names of variables as strings can not break the chain.
+const ParentKey = "milisp parent"
+
+// NewScope creates environment chained to parent. It is cheap unlike copying
+// of environment, so it is a good way to get local scope for function call.
+//
+// Scope is a map of its own variables and a hidden link to parent. Methods Lookup, Set, SetOuter,
+// Names and Parent work through the chain: variables of parent and its ancestors are visible,
+// new variables are set locally and hide variables of parents with the same names.
+// Symbols are evaluated by Lookup. Operations that use these methods work with scopes and with
+// plain environments alike. Map itself knows nothing about the chain: env[name], len(env) and
+// range over env see own variables and the link under ParentKey; the link is not a variable,
+// methods skip it.
+func NewScope(parent Environment) Environment {
+	return Environment{ParentKey: parent}
+}
+
+// Parent returns parent scope or nil, see NewScope.
+func (env Environment) Parent() Environment {
+	p, _ := env[ParentKey].(Environment)
+	return p
+}
+
+// Lookup finds variable in environment, in its parents or in base, the nearest scope wins.
+func (env Environment) Lookup(name string) (interface{}, bool) {
+	if name == ParentKey {
+		return nil, false
+	}
+	for e := env; e != nil; {
+		if v, ok := e[name]; ok {
+			return v, true
+		}
+		switch p := e[ParentKey].(type) { // one more map access per scope, Parent is not used
+		case Environment:
+			e = p
+		case *Base:
+			return p.Lookup(name)
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// Set sets variable in environment itself. It is the same as env[name] = value,
+// except the name ParentKey that is reserved: Set ignores it.
+func (env Environment) Set(name string, value interface{}) {
+	if name == ParentKey {
+		return
+	}
+	env[name] = value
+}
+
+// SetOuter sets variable in the nearest scope that has it, like assignment to outer variable does.
+// If no scope has it, variable is set in environment itself. Base is never modified: variable
+// of base is hidden by variable of overlay, see Base.Overlay. Like Set, SetOuter ignores ParentKey.
+func (env Environment) SetOuter(name string, value interface{}) {
+	if name == ParentKey {
+		return
+	}
+	for e := env; e != nil; e = e.Parent() {
+		if _, ok := e[name]; ok {
+			e[name] = value
+			return
+		}
+	}
+	env[name] = value
+}
+
+// Names returns names of all variables visible in environment, including parents and base.
+// Every name is returned once. Names are not sorted.
+func (env Environment) Names() []string {
+	res := []string(nil)
+	seen := map[string]bool{ParentKey: true}
+	add := func(e Environment) {
+		for k := range e {
+			if !seen[k] {
+				seen[k] = true
+				res = append(res, k)
+			}
+		}
+	}
+	for e := env; e != nil; e = e.Parent() {
+		add(e)
+		if b, ok := e[ParentKey].(*Base); ok {
+			add(b.vars)
+		}
+	}
+	return res
+}
+
+// Base is read-only environment shared by concurrent evaluations: operations and constants
+// that are set up once (by init program, for example). Base has no way to be modified,
+// evaluations work in its overlays:
+//
+//	base := milisp.Freeze(env) // env is set up by init program
+//	// in every goroutine
+//	local := base.Overlay() // cheap scope for inputs and temporaries
+//	local.Set("x", x)
+//	res, err := expr.Eval(local)
+//
+// Base is safe for concurrent use. Like any scope, overlay is not safe for concurrent use itself.
+// Pay attention, values are not copied, so operations must not modify values of base in place.
+type Base struct {
+	vars Environment
+}
+
+// Freeze returns base with all variables that are visible in environment, including parents.
+// Environment is copied, so the following changes of it don't affect base.
+func Freeze(env Environment) *Base {
+	vars := Environment{}
+	for _, k := range env.Names() {
+		vars[k], _ = env.Lookup(k)
+	}
+	return &Base{vars: vars}
+}
+
+// Lookup finds variable in base.
+func (b *Base) Lookup(name string) (interface{}, bool) {
+	v, ok := b.vars[name]
+	return v, ok
+}
+
+// Names returns names of all variables of base. Names are not sorted.
+func (b *Base) Names() []string {
+	res := make([]string, 0, len(b.vars))
+	for k := range b.vars {
+		res = append(res, k)
+	}
+	return res
+}
+
+// Overlay creates new empty environment over base. Variables of base are visible through Lookup
+// like variables of parent scope, however overlay has no parent: Parent returns nil, SetOuter and Set
+// set variables in overlay. So variables that evaluation sets are dropped with overlay.
+func (b *Base) Overlay() Environment {
+	return Environment{ParentKey: b}
+}
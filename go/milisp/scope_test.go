@@ -0,0 +1,271 @@
+package milisp_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+func TestScope(t *testing.T) {
+	global := milisp.Environment{"x": 1., "y": 2.}
+	local := milisp.NewScope(global)
+	local.Set("x", 10.)
+	inner := milisp.NewScope(local)
+	if inner.Parent()["x"] != 10. || inner.Parent().Parent()["x"] != 1. || global.Parent() != nil {
+		t.Fatalf("Unexpected chain: %v", inner)
+	}
+	for _, c := range []struct {
+		name  string
+		value interface{}
+		ok    bool
+	}{
+		{name: "x", value: 10., ok: true}, // the nearest scope wins
+		{name: "y", value: 2., ok: true},
+		{name: "z", value: nil, ok: false},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			v, ok := inner.Lookup(c.name)
+			if v != c.value || ok != c.ok {
+				t.Errorf("Unexpected value: %v, %v", v, ok)
+			}
+		})
+	}
+	inner.SetOuter("y", 20.) // existing variable of global scope
+	inner.SetOuter("z", 30.) // new variable
+	if global["y"] != 20. || len(global) != 2 || len(local) != 2 || inner["z"] != 30. {
+		t.Errorf("Unexpected scopes: global=%v local=%v inner=%v", global, local, inner)
+	}
+	names := inner.Names()
+	sort.Strings(names)
+	if strings.Join(names, ",") != "x,y,z" {
+		t.Errorf("Unexpected names: %v", names)
+	}
+}
+
+func TestScope_eval(t *testing.T) {
+	global := milisp.Environment{
+		"P":   milisp.ContextOpFunc(evalAllReturnLastResult),
+		"set": milisp.ContextOpFunc(setVar),
+		"+":   milisp.ContextOpFunc(sumAll),
+		"x":   1.,
+	}
+	expr, err := milisp.Compile("(P (set y (+ x 1)) (+ x y))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, eval := range []func(milisp.Environment) (interface{}, error){
+		expr.Eval,
+		func(env milisp.Environment) (interface{}, error) {
+			return milisp.EvalContext(context.Background(), env, expr)
+		},
+	} {
+		local := milisp.NewScope(global)
+		res, err := eval(local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != 3. {
+			t.Errorf("Unexpected result: %v", res)
+		}
+		if local["y"] != 2. || len(global) != 4 {
+			t.Errorf("Variable has to be set in local scope: global=%v local=%v", global, local)
+		}
+	}
+	local := milisp.NewScope(global)
+	local.Set("y", 2.)
+	expr, err = milisp.Compile("(+ x y z)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := milisp.Symbols(expr).Missing(local)
+	if len(missing) != 1 || missing[0].Name() != "z" {
+		t.Errorf("Unexpected missing symbols: %v", missing)
+	}
+}
+
+func TestScope_reservedName(t *testing.T) {
+	base := milisp.Freeze(milisp.Environment{
+		"prog":         milisp.ContextOpFunc(evalAllReturnLastResult),
+		"set_str_list": milisp.OpFunc(opSetStringList),
+		"K":            1.,
+	})
+	expr, err := milisp.Compile(`(prog (set_str_list "milisp parent" "5") K)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, env := range []milisp.Environment{base.Overlay(), milisp.NewScope(base.Overlay())} {
+		res, err := expr.Eval(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != 1. {
+			t.Errorf("Unexpected result: %v", res)
+		}
+		env.SetOuter(milisp.ParentKey, 5.)
+		if _, ok := env.Lookup(milisp.ParentKey); ok || len(env.Names()) != 3 {
+			t.Errorf("Link is visible as variable: %v", env.Names())
+		}
+		if v, _ := milisp.Freeze(env).Lookup("K"); v != 1. {
+			t.Errorf("Chain is broken: %v", env)
+		}
+	}
+}
+
+func ExampleNewScope() {
+	global := milisp.Environment{
+		"+":     milisp.ContextOpFunc(sumAll),
+		"rate":  .5,
+		"price": 100.,
+	}
+	request := milisp.NewScope(global) // global is not copied and is not changed
+	request.Set("price", 10.)
+	res, err := milisp.EvalCode(request, "(+ price rate)")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(os.Stdout, res, global["price"])
+	// Output:
+	// 10.5 100
+}
+
+func TestFreeze(t *testing.T) {
+	env := milisp.NewScope(milisp.Environment{"x": 1., "y": 2.})
+	env.Set("x", 10.)
+	base := milisp.Freeze(env)
+	env.Set("y", 20.) // base is a copy
+	if v, ok := base.Lookup("x"); v != 10. || !ok {
+		t.Errorf("Unexpected x: %v, %v", v, ok)
+	}
+	if v, ok := base.Lookup("y"); v != 2. || !ok {
+		t.Errorf("Unexpected y: %v, %v", v, ok)
+	}
+	names := base.Names()
+	sort.Strings(names)
+	if strings.Join(names, ",") != "x,y" {
+		t.Errorf("Unexpected names: %v", names)
+	}
+	local := base.Overlay()
+	if local.Parent() != nil || len(local.Names()) != 2 {
+		t.Fatalf("Unexpected overlay: %v", local.Names())
+	}
+	local.SetOuter("x", 20.) // base is never modified
+	inner := milisp.NewScope(local)
+	inner.SetOuter("y", 30.)
+	if v, _ := base.Lookup("x"); v != 10. || local["x"] != 20. || inner["y"] != 30. {
+		t.Errorf("Unexpected scopes: base=%v local=%v", v, local)
+	}
+	if v, _ := inner.Lookup("x"); v != 20. || len(inner.Names()) != 2 {
+		t.Errorf("Unexpected inner scope: %v, %v", v, inner.Names())
+	}
+	if v, _ := milisp.Freeze(inner).Lookup("y"); v != 30. {
+		t.Errorf("Unexpected refrozen y: %v", v)
+	}
+}
+
+func TestFreeze_eval(t *testing.T) {
+	base := milisp.Freeze(milisp.Environment{
+		"P":   milisp.ContextOpFunc(evalAllReturnLastResult),
+		"set": milisp.ContextOpFunc(setVar),
+		"x":   1.,
+	})
+	expr, err := milisp.Compile("(P (set x 2) (set y 3) [x y])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, eval := range []func(milisp.Environment) (interface{}, error){
+		expr.Eval,
+		func(env milisp.Environment) (interface{}, error) {
+			return milisp.EvalContext(context.Background(), env, expr)
+		},
+	} {
+		local := base.Overlay()
+		res, err := eval(local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(res) != "[2 3]" { // sibling sets are visible
+			t.Errorf("Unexpected result: %v", res)
+		}
+		if fmt.Sprint(local["x"], local["y"]) != "2 3" {
+			t.Errorf("Variables have to be set in overlay: %v", local)
+		}
+	}
+	if v, _ := base.Lookup("x"); v != 1. || len(base.Names()) != 3 {
+		t.Errorf("Base is modified: %v", base.Names())
+	}
+}
+
+// TestFreeze_concurrent is meaningful with race detector: go test -race.
+func TestFreeze_concurrent(t *testing.T) {
+	init := milisp.Environment{
+		"vector":       milisp.OpFunc(opVector),
+		"and":          milisp.OpFunc(opAnd),
+		"in":           milisp.OpFunc(opIn),
+		"prog":         milisp.ContextOpFunc(evalAllReturnLastResult),
+		"set_str_list": milisp.OpFunc(opSetStringList),
+	}
+	_, err := milisp.EvalCode(init, `(prog (set_str_list "UK" "+44") (set_str_list "IL" "+972"))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := milisp.Freeze(init)
+	// every evaluation sets temporary variable and reads constants and inputs
+	expr, err := milisp.Compile(`(prog
+		(set_str_list "RU" "+7")
+		(vector (in code UK) (in code IL) (in code RU)))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := milisp.Compile(`(prog (set_str_list "RU" "+7") (in "+7" RU))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := []string{"+44", "+972", "+7", "+1"}
+	expected := []string{"[1 0 0]", "[0 1 0]", "[0 0 1]", "[0 0 0]"}
+	errs := make(chan error, 100)
+	wg := sync.WaitGroup{}
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			local := base.Overlay()
+			local.Set("code", codes[i%len(codes)])
+			var res interface{}
+			var err error
+			switch i % 3 {
+			case 0:
+				res, err = expr.Eval(local)
+			case 1:
+				res, err = milisp.EvalContext(context.Background(), local, expr, milisp.WithBudget(100))
+			default: // without inputs
+				res, err = direct.Eval(base.Overlay())
+				if err == nil && res != true {
+					err = fmt.Errorf("unexpected result: %v", res)
+				}
+				errs <- err
+				return
+			}
+			if err == nil && fmt.Sprint(res) != expected[i%len(codes)] {
+				err = fmt.Errorf("unexpected result for %s: %v", codes[i%len(codes)], res)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if _, ok := base.Lookup("RU"); ok || len(base.Names()) != 7 {
+		t.Errorf("Base is modified: %v", base.Names())
+	}
+}
@@ -0,0 +1,72 @@
+package milisp
+
+// SymbolRefs lists symbols referenced by expression in order of appearance.
+// Pay attention, operation is free to treat its argument as a bare name
+// (like x in (set x 1)) without evaluation, so not all arguments are required in environment.
+type SymbolRefs struct {
+	Operators []*Symbol // symbols in operator position: the first items of lists
+	Arguments []*Symbol // all other symbols, including the root expression if it is a symbol
+}
+
+// Symbols collects all symbols referenced by expression.
+// Symbol is classified by its position, so a node shared by several lists
+// is reported once for each occurrence.
+func Symbols(e Expression) SymbolRefs {
+	refs := SymbolRefs{}
+	refs.collect(e, false)
+	return refs
+}
+
+func (r *SymbolRefs) collect(e Expression, operator bool) {
+	if s, ok := e.(*Symbol); ok {
+		if operator {
+			r.Operators = append(r.Operators, s)
+		} else {
+			r.Arguments = append(r.Arguments, s)
+		}
+		return
+	}
+	parent, items := children(e)
+	if prog, ok := e.(*Program); ok {
+		items = prog.exprs
+	}
+	_, isList := parent.(*List)
+	for i, x := range items {
+		r.collect(x, isList && i == 0)
+	}
+}
+
+// Names returns unique names of operators and arguments.
+func (r SymbolRefs) Names() ([]string, []string) {
+	return uniqueNames(r.Operators), uniqueNames(r.Arguments)
+}
+
+// Missing returns symbols that are not found in environment. Operators
+// that are found, however, are not an Operation, are considered as missing too.
+func (r SymbolRefs) Missing(env Environment) []*Symbol {
+	res := []*Symbol(nil)
+	for _, s := range r.Operators {
+		x, _ := env.Lookup(s.name)
+		if _, ok := x.(Operation); !ok {
+			res = append(res, s)
+		}
+	}
+	for _, s := range r.Arguments {
+		if _, ok := env.Lookup(s.name); !ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func uniqueNames(ss []*Symbol) []string {
+	res := []string(nil)
+	seen := map[string]bool{}
+	for _, s := range ss {
+		if !seen[s.name] {
+			seen[s.name] = true
+			res = append(res, s.name)
+		}
+	}
+	return res
+}
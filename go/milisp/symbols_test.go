@@ -0,0 +1,86 @@
+package milisp_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+func TestSymbols(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		ops  string
+		args string
+	}{
+		{"X", "[]", "[SYM:X@1:1]"},
+		{"1", "[]", "[]"},
+		{"()", "[]", "[]"},
+		{`(f x "s" (g 1 y) ((h) z))`, "[SYM:f@1:2 SYM:g@1:11 SYM:h@1:20]", "[SYM:x@1:4 SYM:y@1:15 SYM:z@1:23]"},
+		{`(f '(g x) (quote y))`, "[SYM:f@1:2]", "[]"},
+	} {
+		c := c
+		t.Run(c.text, func(t *testing.T) {
+			expr, err := milisp.Compile(c.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			refs := milisp.Symbols(expr)
+			if fmt.Sprint(refs.Operators) != c.ops {
+				t.Errorf("Unexpected operators: %v", refs.Operators)
+			}
+			if fmt.Sprint(refs.Arguments) != c.args {
+				t.Errorf("Unexpected arguments: %v", refs.Arguments)
+			}
+		})
+	}
+}
+
+func TestSymbols_sharedNode(t *testing.T) {
+	x := milisp.NewSymbol("x", milisp.Position{Line: 1, Column: 1})
+	expr := milisp.NewList([]milisp.Expression{
+		milisp.NewList([]milisp.Expression{x, x}, milisp.Position{}),
+		x,
+	}, milisp.Position{})
+	refs := milisp.Symbols(expr)
+	if fmt.Sprint(refs.Operators) != "[SYM:x@1:1]" {
+		t.Errorf("Unexpected operators: %v", refs.Operators)
+	}
+	if fmt.Sprint(refs.Arguments) != "[SYM:x@1:1 SYM:x@1:1]" {
+		t.Errorf("Unexpected arguments: %v", refs.Arguments)
+	}
+}
+
+func ExampleSymbols() {
+	expr, err := milisp.Compile(`
+	(vector
+	    (and (in phoneCountryCode UK) (in phoneAreaCode LDN))
+	    (and (in phoneCountryCode IL) (in phoneAreaCode TLV)))`)
+	if err != nil {
+		panic(err)
+	}
+	refs := milisp.Symbols(expr)
+	fmt.Println(refs.Names())
+	env := milisp.Environment{
+		"vector": milisp.OpFunc(opVector),
+		"and":    milisp.OpFunc(opAnd),
+		"in":     "not an operation",
+		"UK":     []string{"+44"},
+		"LDN":    []string{"020"},
+		"IL":     []string{"+972"},
+	}
+	for _, s := range refs.Missing(env) {
+		fmt.Println("missing:", s.Name(), "at", s.Position())
+	}
+	// Output:
+	// [vector and in] [phoneCountryCode UK phoneAreaCode LDN IL TLV]
+	// missing: in at 3:19
+	// missing: in at 3:44
+	// missing: in at 4:19
+	// missing: in at 4:44
+	// missing: phoneCountryCode at 3:22
+	// missing: phoneAreaCode at 3:47
+	// missing: phoneCountryCode at 4:22
+	// missing: phoneAreaCode at 4:47
+	// missing: TLV at 4:61
+}
@@ -1,8 +1,11 @@
 package milisp
 
 import (
-	"fmt"
+	"errors"
+	"io"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 const opNop = 0
@@ -14,7 +17,13 @@ const (
 	sString
 	sQuotedString
 	sCharAfterSlash
+	sEscapeHex
+	sHash
+	sHashWord
 	sComment
+	sBlockComment
+	sBlockCommentBar
+	sBlockCommentHash
 	sStop
 )
 
@@ -28,6 +37,9 @@ const (
 	cOther
 	cCommentStart
 	cNewLine
+	cBar        // | is a part of symbols, however it starts block comment after #
+	cSemicolon  // ; is a part of symbols, however it starts datum comment after #
+	cApostrophe // ' is a part of symbols, however it quotes expression at the beginning of token
 )
 
 const (
@@ -40,6 +52,17 @@ const (
 	opStopOk
 	opErrorChar
 	opErrorEOF
+	opStartEscape
+	opAppendEscaped
+	opAppendHex
+	opErrorEscape
+	opSaveHashToken
+	opSaveComment
+	opOpenBlockComment
+	opCloseBlockComment
+	opErrorCommentEOF
+	opDatumComment
+	opQuoteToken
 )
 
 // States, char classes and operations for positioning FSM
@@ -63,95 +86,458 @@ const (
 	opStepTab
 )
 
-func tokenize(text string) ([]universalToken, error) {
-	tokenState := sSpaces
-	lineState := sLine
-	line := 1
-	pos := 1
-	tokens := []universalToken(nil)
-	chars := []rune(nil)
+// lexer reads runes one by one and emits tokens as soon as they are recognized.
+type lexer struct {
+	r          io.RuneReader
+	cfg        *config
+	tokenState int
+	lineState  int
+	line       int // legacy position: tab is 8 columns
+	pos        int
+	loc        Location // precise location of current char
+	nextLoc    Location // location of the next char
+	chars      []rune
+	startLine  int
+	startPos   int
+	startLoc   Location
+	escLine    int // position of backslash of escape sequence
+	escPos     int
+	escLoc     Location
+	hex        []rune // digits of \uXXXX and \UXXXXXXXX sequences
+	hexLen     int
+	queue      []universalToken // tokens recognized, but not taken yet
+	done       bool
+	comments   bool           // emit comment tokens for lossless representation
+	blockDepth int            // nesting level of block comments
+	recovering bool           // collect errors and go on instead of stop
+	errs       []*SyntaxError // errors collected in recovering mode
+}
+
+func newLexer(r io.RuneReader, cfg *config) *lexer {
+	return &lexer{
+		r:          r,
+		cfg:        cfg,
+		tokenState: sSpaces,
+		lineState:  sLine,
+		line:       1,
+		pos:        1,
+		loc:        Location{Line: 1, Column: 1, UTF16Column: 1},
+	}
+}
+
+// next returns the next token. It returns false at the end of input.
+func (l *lexer) next() (universalToken, bool, error) {
+	for len(l.queue) == 0 {
+		if l.done {
+			return universalToken{}, false, nil
+		}
+		err := l.step()
+		if err != nil {
+			l.done = true
+			l.queue = nil
+			return universalToken{}, false, err
+		}
+	}
+	t := l.queue[0]
+	l.queue = l.queue[1:]
+	return t, true, nil
+}
+
+// step reads one rune (or EOF) and performs FSM transition.
+func (l *lexer) step() error {
+	ch, size, err := l.r.ReadRune()
+	var tp, spTp int
+	switch {
+	case errors.Is(err, io.EOF):
+		tp, spTp = cEOF, cChar
+	case err != nil:
+		return err
+	default:
+		tp, spTp = charType(ch)
+	}
+	l.nextLoc = nextLocation(l.lineState, l.loc, ch, size, spTp)
+	// tokenization
 	var op int
-	startLine := line
-	startPos := pos
-	for _, ch := range text + "\x1b" {
-		// classify char
-		tp, spTp := charType(ch)
-		// tokenization
-		tokenState, op = tokenizeStateTransitionFunction(tokenState, tp)
-		if op&opErrorChar > 0 {
-			return nil, fmt.Errorf("unexpected char %c at %d:%d", ch, line, pos)
-		}
-		if op&opErrorEOF > 0 {
-			return nil, fmt.Errorf("unexpected EOF")
-		}
-		if op&opNewToken > 0 {
-			startLine = line
-			startPos = pos
-			chars = nil
-		}
-		if op&opAppendChar > 0 {
-			chars = append(chars, ch)
-		}
-		if op&opSaveToken > 0 {
-			s := string(chars)
-			f, err := strconv.ParseFloat(s, 64)
-			if err == nil {
-				tokens = append(tokens, universalToken{
-					tp:   tpNumber,
-					num:  f,
-					str:  s,
-					line: startLine,
-					pos:  startPos,
-				})
+	prevState := l.tokenState
+	l.tokenState, op = tokenizeStateTransitionFunction(l.tokenState, tp)
+	if op&opErrorChar > 0 {
+		inSymbol := ""
+		if prevState == sString {
+			inSymbol = " in symbol"
+		}
+		span := l.span(l.loc, l.nextLoc)
+		pos := Position{Line: l.line, Column: l.pos}
+		err := newSyntaxError(span, pos, string(ch), "unexpected char %c%s at %s", ch, inSymbol, where(pos, span))
+		if !l.recovering {
+			return err
+		}
+		l.errs = append(l.errs, err) // skip char and go on
+		l.tokenState = prevState
+		op = opNop
+	}
+	if op&opErrorEOF > 0 {
+		span := l.span(l.startLoc, l.loc)
+		pos := Position{Line: l.startLine, Column: l.startPos}
+		err := newSyntaxError(span, pos, "\"", "unterminated string started at %s", where(pos, span))
+		if !l.recovering {
+			return err
+		}
+		l.errs = append(l.errs, err)
+		l.done = true
+		return nil
+	}
+	if op&opErrorCommentEOF > 0 {
+		span := l.span(l.startLoc, l.loc)
+		pos := Position{Line: l.startLine, Column: l.startPos}
+		err := newSyntaxError(span, pos, "#|", "unterminated block comment started at %s", where(pos, span))
+		if !l.recovering {
+			return err
+		}
+		l.errs = append(l.errs, err)
+		l.done = true
+		return nil
+	}
+	if op&opErrorEscape > 0 {
+		err := l.escapeError(ch)
+		if !l.recovering {
+			return err
+		}
+		l.errs = append(l.errs, err) // drop escape sequence and go on
+		l.tokenState, op = tokenizeStateTransitionFunction(sQuotedString, tp)
+	}
+	if op&(opStartEscape|opAppendEscaped|opAppendHex) > 0 {
+		err := l.escape(op, ch)
+		if err != nil {
+			return err
+		}
+	}
+	if op&opNewToken > 0 {
+		l.startLine = l.line
+		l.startPos = l.pos
+		l.startLoc = l.loc
+		l.chars = nil
+	}
+	if op&opAppendChar > 0 {
+		l.chars = append(l.chars, ch)
+	}
+	if op&opSaveToken > 0 {
+		err := l.saveToken()
+		if err != nil {
+			return err
+		}
+	}
+	if op&opSaveHashToken > 0 {
+		ok, err := l.saveHashToken()
+		if err != nil {
+			return err
+		}
+		if !ok { // it is comment
+			op &^= opOpenToken | opCloseToken
+			if tp != cNewLine && tp != cEOF {
+				l.tokenState = sComment
 			} else {
-				tokens = append(tokens, universalToken{
-					tp:   tpSymbol,
-					str:  string(chars),
-					line: startLine,
-					pos:  startPos,
-				})
+				l.saveComment(l.loc)
+			}
+		}
+	}
+	if op&opSaveComment > 0 {
+		l.saveComment(l.loc)
+	}
+	if op&opOpenBlockComment > 0 {
+		l.blockDepth++
+	}
+	if op&opCloseBlockComment > 0 {
+		l.blockDepth--
+		if l.blockDepth > 0 {
+			l.tokenState = sBlockComment
+		} else {
+			l.saveComment(l.nextLoc)
+		}
+	}
+	if op&opDatumComment > 0 {
+		l.queue = append(l.queue, l.token(tpDatumComment, "#;", l.nextLoc))
+	}
+	if op&opSaveQuotedToken > 0 {
+		l.queue = append(l.queue, l.token(tpString, string(l.chars), l.nextLoc)) // including closing quote
+	}
+	if op&opOpenToken > 0 {
+		l.queue = append(l.queue, l.charToken(tpOpen, string(ch))) // ( [ {
+	}
+	if op&opCloseToken > 0 {
+		l.queue = append(l.queue, l.charToken(tpClose, string(ch))) // ) ] }
+	}
+	if op&opQuoteToken > 0 {
+		l.queue = append(l.queue, l.charToken(tpQuote, "'"))
+	}
+	if op&opStopOk > 0 { // have to be tha last operation
+		l.done = true
+		return nil
+	}
+	// find out position of next char
+	l.lineState, l.line, l.pos = nextPosition(l.lineState, l.line, l.pos, spTp)
+	l.loc = l.nextLoc
+	return nil
+}
+
+func (l *lexer) span(start, end Location) Span {
+	return Span{Source: l.cfg.source, Start: start, End: end}
+}
+
+// token creates token that starts at the start of current token.
+func (l *lexer) token(tp int, str string, end Location) universalToken {
+	return universalToken{
+		tp:   tp,
+		str:  str,
+		line: l.startLine,
+		pos:  l.startPos,
+		span: l.span(l.startLoc, end),
+	}
+}
+
+// charToken creates token of current char.
+func (l *lexer) charToken(tp int, str string) universalToken {
+	return universalToken{
+		tp:   tp,
+		str:  str,
+		line: l.line,
+		pos:  l.pos,
+		span: l.span(l.loc, l.nextLoc),
+	}
+}
+
+// escape processes escape sequences: \n, \t, \r, \\, \", \uXXXX and \UXXXXXXXX.
+func (l *lexer) escape(op int, ch rune) error {
+	switch {
+	case op&opStartEscape > 0:
+		l.escLine = l.line
+		l.escPos = l.pos
+		l.escLoc = l.loc
+	case op&opAppendEscaped > 0:
+		switch ch {
+		case 'n':
+			l.chars = append(l.chars, '\n')
+		case 't':
+			l.chars = append(l.chars, '\t')
+		case 'r':
+			l.chars = append(l.chars, '\r')
+		case '\\', '"':
+			l.chars = append(l.chars, ch)
+		case 'u', 'U':
+			l.hex = []rune{ch}
+			l.hexLen = 4
+			if ch == 'U' {
+				l.hexLen = 8
 			}
+			l.tokenState = sEscapeHex
+		default:
+			span := l.span(l.escLoc, l.nextLoc)
+			pos := Position{Line: l.escLine, Column: l.escPos}
+			err := newSyntaxError(span, pos, "\\"+string(ch), "unknown escape sequence \\%c at %s", ch, where(pos, span))
+			if !l.recovering {
+				return err
+			}
+			l.errs = append(l.errs, err) // take char as is
+			l.chars = append(l.chars, ch)
+		}
+	case op&opAppendHex > 0:
+		if !isHexDigit(ch) {
+			err := l.escapeError(ch)
+			if !l.recovering {
+				return err
+			}
+			l.errs = append(l.errs, err) // drop escape sequence, take char as is
+			l.chars = append(l.chars, ch)
+			l.tokenState = sQuotedString
+			return nil
 		}
-		if op&opSaveQuotedToken > 0 {
-			tokens = append(tokens, universalToken{
-				tp:   tpString,
-				str:  string(chars),
-				line: startLine,
-				pos:  startPos,
-			})
-		}
-		if op&opOpenToken > 0 {
-			tokens = append(tokens, universalToken{
-				tp:   tpOpen,
-				str:  "(",
-				line: line,
-				pos:  pos,
-			})
-		}
-		if op&opCloseToken > 0 {
-			tokens = append(tokens, universalToken{
-				tp:   tpClose,
-				str:  ")",
-				line: line,
-				pos:  pos,
-			})
-		}
-		if op&opStopOk > 0 { // have to be tha last operation
-			break
-		}
-		// find out position of next char
-		lineState, op = charPositionStateTransitionFunction(lineState, spTp)
-		switch op {
-		case opNewLine:
-			line++
-			pos = 1
-		case opStepOne:
-			pos++
-		case opStepTab:
-			pos += 8 - (pos-1)%8
-		}
-	}
-	return tokens, nil
+		l.hex = append(l.hex, ch)
+		if len(l.hex) <= l.hexLen {
+			return nil
+		}
+		l.tokenState = sQuotedString
+		code, _ := strconv.ParseUint(string(l.hex[1:]), 16, 32) // digits are checked
+		if !utf8.ValidRune(rune(code)) {
+			err := l.escapeError(0)
+			if !l.recovering {
+				return err
+			}
+			l.errs = append(l.errs, err) // drop escape sequence
+			return nil
+		}
+		l.chars = append(l.chars, rune(code))
+	}
+	return nil
+}
+
+func (l *lexer) escapeError(ch rune) *SyntaxError {
+	seq := "\\" + string(l.hex)
+	if ch != 0 {
+		seq += string(ch)
+	}
+	span := l.span(l.escLoc, l.nextLoc)
+	pos := Position{Line: l.escLine, Column: l.escPos}
+	return newSyntaxError(span, pos, seq, "invalid escape sequence %s at %s", seq, where(pos, span))
+}
+
+func isHexDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// saveToken saves integer, float or symbol.
+func (l *lexer) saveToken() error {
+	s := string(l.chars)
+	t := l.token(tpSymbol, s, l.loc)
+	if n, ok, err := parseInteger(s); ok {
+		if err != nil {
+			pos := Position{Line: t.line, Column: t.pos}
+			cause := err
+			err := newSyntaxError(t.span, pos, s, "integer %s out of range at %s", s, where(pos, t.span))
+			err.Err = cause
+			if !l.recovering {
+				return err
+			}
+			l.errs = append(l.errs, err) // go on, take it as float
+		} else {
+			t.tp = tpInteger
+			t.integer = n
+			l.queue = append(l.queue, t)
+			return nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err == nil {
+		t.tp = tpNumber
+		t.num = f
+		l.queue = append(l.queue, t)
+		return nil
+	}
+	_, err = l.saveLiteral(t)
+	return err
+}
+
+// saveComment saves comment started by # if lexer works for lossless representation.
+func (l *lexer) saveComment(end Location) {
+	if !l.comments {
+		return
+	}
+	l.queue = append(l.queue, l.token(tpComment, "#", end))
+}
+
+// saveHashToken saves word like #t, if it is recognized as literal. Otherwise it is comment.
+func (l *lexer) saveHashToken() (bool, error) {
+	return l.saveLiteral(l.token(tpSymbol, string(l.chars), l.loc))
+}
+
+// saveLiteral saves token as custom literal if it is recognized. Symbols are saved as is,
+// words that start with # are dropped.
+func (l *lexer) saveLiteral(t universalToken) (bool, error) {
+	v, ok, err := l.cfg.literal(t.str)
+	if err != nil {
+		pos := Position{Line: t.line, Column: t.pos}
+		cause := err
+		err := newSyntaxError(t.span, pos, t.str, "%s at %s", err, where(pos, t.span))
+		err.Err = cause
+		if !l.recovering {
+			return false, err
+		}
+		l.errs = append(l.errs, err) // go on, consider it as symbol
+	}
+	if ok && err == nil {
+		t.tp = tpLiteral
+		t.value = v
+	}
+	if !ok && strings.HasPrefix(t.str, "#") {
+		return false, nil
+	}
+	l.queue = append(l.queue, t)
+	return true, nil
+}
+
+// parseInteger parses decimal and hexadecimal (0x) integers with optional sign and underscores between digits.
+// Leading zeros don't mean octal. It returns false if s is not integer, and error if it is out of int64.
+func parseInteger(s string) (int64, bool, error) {
+	sign := ""
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		sign, s = s[:1], s[1:]
+	}
+	base := 10
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	if len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		base = 16
+		s = s[2:]
+		if s[0] == '_' {
+			s = s[1:] // 0x_ff is allowed
+		}
+		isDigit = func(c byte) bool { return isHexDigit(rune(c)) }
+	}
+	digits := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isDigit(c):
+			digits = append(digits, c)
+		case c == '_' && i > 0 && i < len(s)-1 && isDigit(s[i-1]) && isDigit(s[i+1]):
+		default:
+			return 0, false, nil
+		}
+	}
+	if len(digits) == 0 {
+		return 0, false, nil
+	}
+	n, err := strconv.ParseInt(sign+string(digits), base, 64)
+	return n, true, err
+}
+
+func tokenize(text string, cfg *config) ([]universalToken, error) {
+	return collect(newLexer(strings.NewReader(text), cfg))
+}
+
+func collect(l *lexer) ([]universalToken, error) {
+	tokens := []universalToken(nil)
+	for {
+		t, ok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return tokens, nil
+		}
+		tokens = append(tokens, t)
+	}
+}
+
+// nextLocation moves precise location along with legacy position. It has to be called
+// before nextPosition, because it uses the same lineState.
+func nextLocation(lineState int, loc Location, ch rune, size, spTp int) Location {
+	_, op := charPositionStateTransitionFunction(lineState, spTp)
+	switch op {
+	case opNewLine:
+		loc.Line++
+		loc.Column = 1
+		loc.UTF16Column = 1
+	case opStepOne, opStepTab:
+		loc.Column++
+		loc.UTF16Column++
+		if ch > 0xffff { // surrogate pair
+			loc.UTF16Column++
+		}
+	}
+	loc.Offset += size
+	return loc
+}
+
+func nextPosition(lineState, line, pos, spTp int) (int, int, int) {
+	lineState, op := charPositionStateTransitionFunction(lineState, spTp)
+	switch op {
+	case opNewLine:
+		line++
+		pos = 1
+	case opStepOne:
+		pos++
+	case opStepTab:
+		pos += 8 - (pos-1)%8
+	}
+	return lineState, line, pos
 }
 
 func tokenizeStateTransitionFunction(state int, symbol int) (int, int) {
@@ -161,7 +547,7 @@ func tokenizeStateTransitionFunction(state int, symbol int) (int, int) {
 		case cSpace, cNewLine:
 			return sSpaces, opNop
 		case cCommentStart:
-			return sComment, opNop
+			return sHash, opNewToken | opAppendChar
 		case cBracketOpen:
 			return sSpaces, opOpenToken
 		case cBracketClose:
@@ -172,8 +558,10 @@ func tokenizeStateTransitionFunction(state int, symbol int) (int, int) {
 			return sStop, opErrorChar
 		case cEOF:
 			return sStop, opStopOk
-		case cOther:
+		case cOther, cBar, cSemicolon:
 			return sString, opNewToken | opAppendChar
+		case cApostrophe:
+			return sSpaces, opQuoteToken
 		}
 	case sString:
 		switch symbol {
@@ -187,36 +575,109 @@ func tokenizeStateTransitionFunction(state int, symbol int) (int, int) {
 			return sStop, opErrorChar
 		case cEOF:
 			return sStop, opSaveToken | opStopOk
-		case cOther:
+		case cOther, cBar, cSemicolon, cApostrophe:
 			return sString, opAppendChar
 		}
 	case sQuotedString:
 		switch symbol {
 		case cSlash:
-			return sCharAfterSlash, opNop
+			return sCharAfterSlash, opStartEscape
 		case cQuote:
 			return sSpaces, opSaveQuotedToken
 		case cEOF:
 			return sStop, opErrorEOF
-		case cOther, cSpace, cBracketOpen, cBracketClose, cNewLine, cCommentStart:
+		case cOther, cSpace, cBracketOpen, cBracketClose, cNewLine, cCommentStart, cBar, cSemicolon, cApostrophe:
 			return sQuotedString, opAppendChar
 		}
 	case sCharAfterSlash:
 		switch symbol {
 		case cEOF:
 			return sStop, opErrorEOF
-		case cSlash, cQuote, cOther, cSpace, cBracketOpen, cBracketClose, cNewLine, cCommentStart:
-			return sQuotedString, opAppendChar
+		case cSlash, cQuote, cOther, cSpace, cBracketOpen, cBracketClose, cNewLine, cCommentStart,
+			cBar, cSemicolon, cApostrophe:
+			return sQuotedString, opAppendEscaped // \uXXXX and \UXXXXXXXX switch state to sEscapeHex
+		}
+	case sEscapeHex:
+		switch symbol {
+		case cEOF:
+			return sStop, opErrorEOF
+		case cOther, cBar, cSemicolon, cApostrophe:
+			return sEscapeHex, opAppendHex // the last digit switches state back to sQuotedString
+		case cSlash, cQuote, cSpace, cBracketOpen, cBracketClose, cNewLine, cCommentStart:
+			return sStop, opErrorEscape
+		}
+	case sHash:
+		switch symbol {
+		case cOther, cApostrophe:
+			return sHashWord, opAppendChar
+		case cBar:
+			return sBlockComment, opOpenBlockComment
+		case cSemicolon:
+			return sSpaces, opDatumComment
+		case cNewLine:
+			return sSpaces, opSaveComment
+		case cEOF:
+			return sStop, opSaveComment | opStopOk
+		case cSpace, cBracketOpen, cBracketClose, cQuote, cSlash, cCommentStart:
+			return sComment, opNop
+		}
+	case sHashWord: // it is custom literal (like #t) or just comment; lexer decides and fixes state if necessary
+		switch symbol {
+		case cOther, cBar, cSemicolon, cApostrophe:
+			return sHashWord, opAppendChar
+		case cSpace, cNewLine:
+			return sSpaces, opSaveHashToken
+		case cBracketOpen:
+			return sSpaces, opSaveHashToken | opOpenToken
+		case cBracketClose:
+			return sSpaces, opSaveHashToken | opCloseToken
+		case cEOF:
+			return sStop, opSaveHashToken | opStopOk
+		case cQuote, cSlash, cCommentStart: // could not be literal
+			return sComment, opNop
 		}
 	case sComment:
 		switch symbol {
 		case cNewLine:
-			return sSpaces, opNop
+			return sSpaces, opSaveComment
 		case cEOF:
-			return sStop, opStopOk
-		case cSlash, cQuote, cOther, cSpace, cBracketOpen, cBracketClose, cCommentStart:
+			return sStop, opSaveComment | opStopOk
+		case cSlash, cQuote, cOther, cSpace, cBracketOpen, cBracketClose, cCommentStart, cBar, cSemicolon, cApostrophe:
 			return sComment, opNop
 		}
+	case sBlockComment:
+		switch symbol {
+		case cBar:
+			return sBlockCommentBar, opNop
+		case cCommentStart:
+			return sBlockCommentHash, opNop
+		case cEOF:
+			return sStop, opErrorCommentEOF
+		case cSlash, cQuote, cOther, cSpace, cBracketOpen, cBracketClose, cNewLine, cSemicolon, cApostrophe:
+			return sBlockComment, opNop
+		}
+	case sBlockCommentBar: // |# closes block comment; lexer fixes state if comment is nested
+		switch symbol {
+		case cCommentStart:
+			return sSpaces, opCloseBlockComment
+		case cBar:
+			return sBlockCommentBar, opNop
+		case cEOF:
+			return sStop, opErrorCommentEOF
+		case cSlash, cQuote, cOther, cSpace, cBracketOpen, cBracketClose, cNewLine, cSemicolon, cApostrophe:
+			return sBlockComment, opNop
+		}
+	case sBlockCommentHash: // #| opens nested block comment
+		switch symbol {
+		case cBar:
+			return sBlockComment, opOpenBlockComment
+		case cCommentStart:
+			return sBlockCommentHash, opNop
+		case cEOF:
+			return sStop, opErrorCommentEOF
+		case cSlash, cQuote, cOther, cSpace, cBracketOpen, cBracketClose, cNewLine, cSemicolon, cApostrophe:
+			return sBlockComment, opNop
+		}
 	}
 	panic("impossible state")
 }
@@ -278,9 +739,9 @@ func charType(ch rune) (int, int) {
 		return cSpace, cTab
 	case 0x20:
 		return cSpace, cChar
-	case '(':
+	case '(', '[', '{':
 		return cBracketOpen, cChar
-	case ')':
+	case ')', ']', '}':
 		return cBracketClose, cChar
 	case '"':
 		return cQuote, cChar
@@ -288,8 +749,12 @@ func charType(ch rune) (int, int) {
 		return cSlash, cChar
 	case '#':
 		return cCommentStart, cChar
-	case 0x1b:
-		return cEOF, cChar
+	case '|':
+		return cBar, cChar
+	case ';':
+		return cSemicolon, cChar
+	case '\'':
+		return cApostrophe, cChar
 	}
 	return cOther, cChar
 }
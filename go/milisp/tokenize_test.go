@@ -34,10 +34,34 @@ func TestTokenize_ok(t *testing.T) {
 			text: `"a\"c"`,
 			res:  `[STR:a"c@1:1]`,
 		},
+		{
+			text: `"\n\t\r\\\""`,
+			res:  "[STR:\n\t\r\\\"@1:1]",
+		},
+		{
+			text: `"\u0041\u00e9\U0001F600 \u0444"`,
+			res:  "[STR:Aé😀 ф@1:1]",
+		},
 		{
 			text: `x #`,
 			res:  `[SYM:x@1:1]`,
 		},
+		{
+			text: "a|b;c #| x\n #| (nested) |# \"\n y |# #;(z) d",
+			res:  "[SYM:a|b;c@1:1 DAT:#;@3:7 BEG:(@3:9 SYM:z@3:10 END:)@3:11 SYM:d@3:13]",
+		},
+		{
+			text: "[a]{#b\nc}#[d",
+			res:  "[BEG:[@1:1 SYM:a@1:2 END:]@1:3 BEG:{@1:4 SYM:c@2:1 END:}@2:2]",
+		},
+		{
+			text: "'a b'c '(x) #'d",
+			res:  "[QUO:'@1:1 SYM:a@1:2 SYM:b'c@1:4 QUO:'@1:8 BEG:(@1:9 SYM:x@1:10 END:)@1:11]",
+		},
+		{
+			text: "#||# #|#|||#||# a",
+			res:  "[SYM:a@1:17]",
+		},
 		{
 			text: "abc x)\n))(y",
 			res:  "[SYM:abc@1:1 SYM:x@1:5 END:)@1:6 END:)@2:1 END:)@2:2 BEG:(@2:3 SYM:y@2:4]",
@@ -45,7 +69,7 @@ func TestTokenize_ok(t *testing.T) {
 	} {
 		c := c
 		t.Run(c.text, func(t *testing.T) {
-			p, err := tokenize(c.text)
+			p, err := tokenize(c.text, &config{})
 			if err != nil {
 				t.Errorf("Unexpected error: %s", err)
 			}
@@ -63,7 +87,7 @@ func TestTokenize_invalid(t *testing.T) {
 	}{
 		{
 			text: `"`,
-			err:  "unexpected EOF",
+			err:  "unterminated string started at 1:1",
 		},
 		{
 			text: `\`,
@@ -71,16 +95,56 @@ func TestTokenize_invalid(t *testing.T) {
 		},
 		{
 			text: `x"`,
-			err:  `unexpected char " at 1:2`,
+			err:  `unexpected char " in symbol at 1:2`,
 		},
 		{
 			text: `"\`,
-			err:  "unexpected EOF",
+			err:  "unterminated string started at 1:1",
+		},
+		{
+			text: `"\u12`,
+			err:  "unterminated string started at 1:1",
+		},
+		{
+			text: ` "\q"`,
+			err:  `unknown escape sequence \q at 1:3`,
+		},
+		{
+			text: `"\u12G4"`,
+			err:  `invalid escape sequence \u12G at 1:2`,
+		},
+		{
+			text: `"\u12"`,
+			err:  `invalid escape sequence \u12" at 1:2`,
+		},
+		{
+			text: `"\UFFFFFFFF"`,
+			err:  `invalid escape sequence \UFFFFFFFF at 1:2`,
+		},
+		{
+			text: `"\uD800"`,
+			err:  `invalid escape sequence \uD800 at 1:2`,
+		},
+		{
+			text: "x #| #| |# |",
+			err:  "unterminated block comment started at 1:3",
+		},
+		{
+			text: "#|#",
+			err:  "unterminated block comment started at 1:1",
+		},
+		{
+			text: "#||",
+			err:  "unterminated block comment started at 1:1",
+		},
+		{
+			text: "a|#",
+			err:  "unexpected char # in symbol at 1:3",
 		},
 	} {
 		c := c
 		t.Run(c.text, func(t *testing.T) {
-			p, err := tokenize(c.text)
+			p, err := tokenize(c.text, &config{})
 			if err == nil {
 				t.Errorf("Unexpected error: %s", err)
 			}
@@ -106,7 +170,75 @@ func assertPanicFSM(f func(int, int) (int, int)) func(t *testing.T) {
 	}
 }
 
+func TestTokenize_completeFSM(t *testing.T) {
+	for state := sSpaces; state < sStop; state++ {
+		for symbol := cSpace; symbol <= cApostrophe; symbol++ {
+			tokenizeStateTransitionFunction(state, symbol) // panics if transition is missing
+		}
+	}
+}
+
 func TestTokenize_panicFSM(t *testing.T) {
 	t.Run("tokenizeStateTransitionFunction", assertPanicFSM(tokenizeStateTransitionFunction))
 	t.Run("charPositionStateTransitionFunction", assertPanicFSM(charPositionStateTransitionFunction))
 }
+
+func TestTokenize_numbers(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		res  string
+	}{
+		{"1", "INT:1"},
+		{"-1", "INT:-1"},
+		{"+1", "INT:1"},
+		{"007", "INT:7"},
+		{"1_000", "INT:1000"},
+		{"0x1F", "INT:31"},
+		{"0X_ff_ff", "INT:65535"},
+		{"-0x8000000000000000", "INT:-9223372036854775808"},
+		{"9007199254740993", "INT:9007199254740993"},
+		{"1.0", "NUM:1"},
+		{"1e3", "NUM:1000"},
+		{"1_000.5", "NUM:1000.5"},
+		{"1__0", "SYM:1__0"},
+		{"_1", "SYM:_1"},
+		{"1_", "SYM:1_"},
+		{"0x", "SYM:0x"},
+		{"0xg", "SYM:0xg"},
+		{"--1", "SYM:--1"},
+		{"+", "SYM:+"},
+	} {
+		c := c
+		t.Run(c.text, func(t *testing.T) {
+			p, err := tokenize(c.text, &config{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			n, err := p[0].node()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			res := ""
+			switch x := n.(type) {
+			case *Integer:
+				res = fmt.Sprintf("INT:%d", x.Value())
+			case *Number:
+				res = fmt.Sprintf("NUM:%v", x.Value())
+			case *Symbol:
+				res = "SYM:" + x.Name()
+			}
+			if res != c.res {
+				t.Errorf("Unexpected result: %s", res)
+			}
+		})
+	}
+	for _, text := range []string{"9223372036854775808", "-0x8000000000000001"} {
+		p, err := tokenize(text, &config{})
+		if err == nil || p != nil {
+			t.Errorf("Error expected: %v", p)
+		}
+		if err.Error() != "integer "+text+" out of range at 1:1" {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	}
+}
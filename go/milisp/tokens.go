@@ -8,33 +8,44 @@ const (
 	tpString
 	tpOpen
 	tpClose
+	tpInteger
+	tpLiteral
+	tpDatumComment // #; comments out the following expression
+	tpComment      // line and block comments, they are emitted for lossless representation only
+	tpQuote
 )
 
 type universalToken struct {
-	tp   int
-	num  float64
-	str  string
-	line int
-	pos  int
+	tp      int
+	num     float64
+	integer int64
+	value   interface{} // value of custom literal
+	str     string
+	line    int // legacy position
+	pos     int
+	span    Span
 }
 
 func (t universalToken) String() string {
-	return fmt.Sprintf("%s:%s@%d:%d", []string{"SYM", "NUM", "STR", "BEG", "END"}[t.tp], t.str, t.line, t.pos)
+	names := []string{"SYM", "NUM", "STR", "BEG", "END", "NUM", "LIT", "DAT", "CMT", "QUO"}
+	return fmt.Sprintf("%s:%s@%d:%d", names[t.tp], t.str, t.line, t.pos)
 }
 
-func (t universalToken) Eval(env Environment) (interface{}, error) {
+// node converts atom token to corresponding node.
+func (t universalToken) node() (Expression, error) {
+	pos := Position{Line: t.line, Column: t.pos}
 	switch t.tp {
 	case tpSymbol:
-		x, ok := env[t.str]
-		if !ok {
-			return nil, fmt.Errorf("runtime error: unknown symbol: %s", t)
-		}
-		return x, nil
+		return &Symbol{name: t.str, pos: pos, span: t.span}, nil
 	case tpNumber:
-		return t.num, nil
+		return &Number{value: t.num, text: t.str, pos: pos, span: t.span}, nil
+	case tpInteger:
+		return &Integer{value: t.integer, text: t.str, pos: pos, span: t.span}, nil
+	case tpLiteral:
+		return &Literal{value: t.value, text: t.str, pos: pos, span: t.span}, nil
 	case tpString:
-		return t.str, nil
-	default: // case tpOpen, tpClose:
-		return nil, fmt.Errorf("runtime error: impossible symbol: %s", t)
+		return &String{value: t.str, pos: pos, span: t.span}, nil
+	default: // case tpOpen, tpClose, tpDatumComment, tpComment, tpQuote:
+		return nil, fmt.Errorf("impossible token: %s", t)
 	}
 }
@@ -0,0 +1,140 @@
+package milisp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Tracer observes evaluation, see WithTracer. Enter and Exit are called around evaluation
+// of every node: Exit gets the result or the error and the duration of evaluation.
+// Constants are reported with zero duration.
+// Pay attention, if operations evaluate arguments in goroutines, tracer has to be safe for concurrent use.
+type Tracer interface {
+	Enter(n Node)
+	Exit(n Node, result interface{}, err error, d time.Duration)
+}
+
+// WithTracer attaches tracer to evaluation. Tracer goes with evaluation, not with environment:
+// it observes arguments that ContextOperation evaluates by EvalContext in any environment, new one too.
+func WithTracer(t Tracer) EvalOption {
+	return func(s *evalState) {
+		s.tracer = t
+	}
+}
+
+const traceWidth = 60 // max length of expression in trace
+
+// TreeTracer prints indented call tree. Node that has nested nodes takes two lines: the first one on entry
+// and the second one with result on exit. Node without nested nodes takes one line:
+//
+//	(* x (+ x 1)) at 1:1
+//	  * at 1:2 = milisp.OpFunc
+//	  x at 1:4 = 2
+//	  (+ x 1) at 1:6
+//	    + at 1:7 = milisp.OpFunc
+//	    x at 1:9 = 2
+//	    1 at 1:11 = 1
+//	  = 3
+//	= 6
+//
+// Zero value uses two spaces and doesn't print durations. TreeTracer is not safe for concurrent use.
+type TreeTracer struct {
+	Out       io.Writer
+	Indent    string
+	Durations bool // print duration of every node
+	depth     int
+	pending   Node // entered node that is not printed yet
+}
+
+// Enter prints node or defers it up to Exit, to print node and result on the same line.
+func (t *TreeTracer) Enter(n Node) {
+	t.flush()
+	t.pending = n
+}
+
+// Exit prints result or error.
+func (t *TreeTracer) Exit(n Node, result interface{}, err error, d time.Duration) {
+	b := strings.Builder{}
+	if t.pending == n {
+		t.pending = nil
+		t.writeNode(&b, n)
+		b.WriteString(" ")
+	} else {
+		t.depth--
+		b.WriteString(strings.Repeat(t.indent(), t.depth))
+	}
+	if err != nil {
+		b.WriteString("! ")
+		b.WriteString(errorLine(err))
+	} else {
+		b.WriteString("= ")
+		b.WriteString(traceValue(result))
+	}
+	if t.Durations {
+		fmt.Fprintf(&b, " (%s)", d)
+	}
+	b.WriteString("\n")
+	_, _ = io.WriteString(t.Out, b.String())
+}
+
+// flush prints pending node as the head of subtree.
+func (t *TreeTracer) flush() {
+	if t.pending == nil {
+		return
+	}
+	b := strings.Builder{}
+	t.writeNode(&b, t.pending)
+	b.WriteString("\n")
+	_, _ = io.WriteString(t.Out, b.String())
+	t.pending = nil
+	t.depth++
+}
+
+func (t *TreeTracer) writeNode(b *strings.Builder, n Node) {
+	b.WriteString(strings.Repeat(t.indent(), t.depth))
+	s, err := formatFlat(n)
+	if err != nil {
+		s = fmt.Sprint(n)
+	}
+	if utf8.RuneCountInString(s) > traceWidth {
+		s = string([]rune(s)[:traceWidth-3]) + "..."
+	}
+	b.WriteString(s)
+	b.WriteString(" at ")
+	b.WriteString(where(n.Position(), n.Span()))
+}
+
+func (t *TreeTracer) indent() string {
+	if t.Indent == "" {
+		return defaultIndent
+	}
+	return t.Indent
+}
+
+// errorLine returns the error itself without trace.
+func errorLine(err error) string {
+	var ee *EvalError
+	if errors.As(err, &ee) {
+		err = ee.Err
+	}
+	s := err.Error()
+	if k := strings.IndexByte(s, '\n'); k >= 0 {
+		s = s[:k]
+	}
+	return s
+}
+
+func traceValue(v interface{}) string {
+	switch x := v.(type) {
+	case Operation:
+		return fmt.Sprintf("%T", x)
+	case string:
+		return quote(x)
+	default:
+		return fmt.Sprint(x)
+	}
+}
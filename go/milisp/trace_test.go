@@ -0,0 +1,143 @@
+package milisp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) Enter(n milisp.Node) {
+	r.events = append(r.events, fmt.Sprintf("enter %s", n.Position()))
+}
+
+func (r *recorder) Exit(n milisp.Node, result interface{}, err error, d time.Duration) {
+	if d < 0 {
+		panic(d)
+	}
+	if err != nil {
+		result = "error"
+	}
+	r.events = append(r.events, fmt.Sprintf("exit %s %v", n.Position(), result))
+}
+
+func TestWithTracer(t *testing.T) {
+	env := milisp.Environment{
+		"P": milisp.ContextOpFunc(evalAllReturnLastResult),
+		"x": 1.,
+	}
+	expr, err := milisp.Compile(`(P "s" ['a x] {"k" 2} () (P y))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{}
+	_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithTracer(r))
+	var target *milisp.UnknownSymbolError
+	if !errors.As(err, &target) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	events := strings.Join(r.events, "\n")
+	expected := strings.Join([]string{
+		"enter 1:1",
+		"enter 1:2", "exit 1:2 " + fmt.Sprint(env["P"]),
+		"enter 1:4", "exit 1:4 s",
+		"enter 1:8",
+		"enter 1:9", "exit 1:9 SYM:a@1:10",
+		"enter 1:12", "exit 1:12 1",
+		"exit 1:8 [SYM:a@1:10 1]",
+		"enter 1:15",
+		"enter 1:16", "exit 1:16 k",
+		"enter 1:20", "exit 1:20 2",
+		"exit 1:15 map[k:2]",
+		"enter 1:23", "exit 1:23 <nil>",
+		"enter 1:26",
+		"enter 1:27", "exit 1:27 " + fmt.Sprint(env["P"]),
+		"enter 1:29", "exit 1:29 error",
+		"exit 1:26 error",
+		"exit 1:1 error",
+	}, "\n")
+	if events != expected {
+		t.Errorf("Unexpected events:\n%s", events)
+	}
+	if len(env) != 2 {
+		t.Errorf("Environment is modified: %v", env)
+	}
+}
+
+func TestWithTracer_newEnvironment(t *testing.T) {
+	env := milisp.Environment{
+		"local": milisp.ContextOpFunc(func(ctx context.Context, _ milisp.Environment, args []milisp.Expression) (interface{}, error) {
+			return milisp.EvalContext(ctx, milisp.Environment{"x": 2.}, args[0])
+		}),
+	}
+	expr, err := milisp.Compile(`(local x)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{}
+	_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithTracer(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := strings.Join(r.events, "\n")
+	expected := strings.Join([]string{
+		"enter 1:1",
+		"enter 1:2", "exit 1:2 " + fmt.Sprint(env["local"]),
+		"enter 1:8", "exit 1:8 2",
+		"exit 1:1 2",
+	}, "\n")
+	if events != expected {
+		t.Errorf("Unexpected events:\n%s", events)
+	}
+}
+
+func ExampleTreeTracer() {
+	env := milisp.Environment{
+		"*": milisp.ContextOpFunc(mulAll),
+		"+": milisp.ContextOpFunc(sumAll),
+		"x": 2.,
+	}
+	expr, err := milisp.Compile("(* x (+ x 1))")
+	if err != nil {
+		panic(err)
+	}
+	tracer := &milisp.TreeTracer{Out: os.Stdout}
+	_, err = milisp.EvalContext(context.Background(), env, expr, milisp.WithTracer(tracer))
+	if err != nil {
+		panic(err)
+	}
+	expr, err = milisp.Compile("(* x [(+ y 1)])")
+	if err != nil {
+		panic(err)
+	}
+	_, _ = milisp.EvalContext(context.Background(), env, expr, milisp.WithTracer(tracer))
+	// Output:
+	// (* x (+ x 1)) at 1:1
+	//   * at 1:2 = milisp.ContextOpFunc
+	//   x at 1:4 = 2
+	//   (+ x 1) at 1:6
+	//     + at 1:7 = milisp.ContextOpFunc
+	//     x at 1:9 = 2
+	//     1 at 1:11 = 1
+	//   = 3
+	// = 6
+	// (* x [(+ y 1)]) at 1:1
+	//   * at 1:2 = milisp.ContextOpFunc
+	//   x at 1:4 = 2
+	//   [(+ y 1)] at 1:6
+	//     (+ y 1) at 1:7
+	//       + at 1:8 = milisp.ContextOpFunc
+	//       y at 1:10 ! runtime error: unknown symbol: SYM:y@1:10
+	//     ! runtime error: unknown symbol: SYM:y@1:10
+	//   ! runtime error: unknown symbol: SYM:y@1:10
+	// ! runtime error: unknown symbol: SYM:y@1:10
+}
@@ -20,3 +20,12 @@ type OpFunc func(env Environment, args []Expression) (interface{}, error)
 func (f OpFunc) Perform(env Environment, args []Expression) (interface{}, error) {
 	return f(env, args)
 }
+
+// Node is an Expression produced by Compile: *Symbol, *Number, *Integer, *String, *Literal,
+// *List, *Quote, *Vector or *Map.
+// Operations are free to inspect their arguments using type switch.
+type Node interface {
+	Expression
+	Position() Position
+	Span() Span
+}
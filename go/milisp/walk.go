@@ -0,0 +1,172 @@
+package milisp
+
+// Visitor's Visit method is invoked for each expression encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of expression with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(e Expression) (w Visitor)
+}
+
+// Walk traverses tree in depth-first order like go/ast.Walk does.
+func Walk(v Visitor, e Expression) {
+	if v = v.Visit(e); v == nil {
+		return
+	}
+	_, items := children(e)
+	if prog, ok := e.(*Program); ok {
+		items = prog.exprs
+	}
+	for _, x := range items {
+		Walk(v, x)
+	}
+	v.Visit(nil)
+}
+
+// children returns items of list, vector or map. It returns nil node for all other expressions.
+func children(e Expression) (Node, []Expression) {
+	switch n := e.(type) {
+	case *List:
+		return n, n.items
+	case *Vector:
+		return n, n.items
+	case *Map:
+		return n, n.items
+	}
+	return nil, nil
+}
+
+// withChildren returns copy of list, vector, map or program with new items.
+func withChildren(e Expression, items []Expression) Expression {
+	switch n := e.(type) {
+	case *Vector:
+		return &Vector{items: items, pos: n.pos, span: n.span}
+	case *Map:
+		return &Map{items: items, pos: n.pos, span: n.span}
+	case *List:
+		return &List{items: items, pos: n.pos, span: n.span}
+	case *Program:
+		return &Program{exprs: items}
+	}
+	return e
+}
+
+type inspector func(Expression) bool
+
+func (f inspector) Visit(e Expression) Visitor {
+	if f(e) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses tree in depth-first order: it starts by calling f(e);
+// if f returns true, Inspect invokes f recursively for each of the children,
+// followed by a call of f(nil).
+func Inspect(e Expression, f func(Expression) bool) {
+	Walk(inspector(f), e)
+}
+
+// Cursor describes an expression encountered during Apply.
+type Cursor struct {
+	node     Expression
+	parent   Node
+	index    int
+	replaced bool
+	deleted  bool
+}
+
+// Node returns the current expression. It is the replacement if Replace has been called.
+func (c *Cursor) Node() Expression {
+	return c.node
+}
+
+// Parent returns the original list that contains the current expression.
+// It returns nil for root and for items of vectors and maps, see ParentNode.
+func (c *Cursor) Parent() *List {
+	l, _ := c.parent.(*List)
+	return l
+}
+
+// ParentNode returns the original list, vector or map that contains the current expression,
+// or nil for root and for top-level expressions of program.
+func (c *Cursor) ParentNode() Node {
+	return c.parent
+}
+
+// Index returns the index of the current expression in the original parent list (or program), or -1 for root.
+func (c *Cursor) Index() int {
+	return c.index
+}
+
+// Replace replaces the current expression. The children of new expression are traversed (if pre-order).
+func (c *Cursor) Replace(e Expression) {
+	c.node = e
+	c.replaced = true
+}
+
+// Delete removes the current expression from its parent list. Apply returns nil if root is deleted.
+// Pay attention, keys and values of map are deleted separately.
+func (c *Cursor) Delete() {
+	c.node = nil
+	c.deleted = true
+}
+
+// ApplyFunc is invoked by Apply for each expression, see Apply for details.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses tree like astutil.Apply does, calling pre and post (if not nil) for each expression.
+// If pre returns false, the children are not traversed and post is not called.
+// If post returns false, traversal is terminated.
+// Apply traverses top-level expressions of *Program like items of list.
+// Apply doesn't change the original tree: the lists (and programs) that have changed items are copied.
+// Apply returns resulting tree.
+func Apply(root Expression, pre, post ApplyFunc) Expression {
+	a := applier{pre: pre, post: post}
+	res, _ := a.apply(nil, -1, root)
+	return res
+}
+
+type applier struct {
+	pre  ApplyFunc
+	post ApplyFunc
+	stop bool
+}
+
+// apply returns resulting expression and a flag that it differs from the original one.
+func (a *applier) apply(parent Node, index int, e Expression) (Expression, bool) {
+	c := &Cursor{node: e, parent: parent, index: index}
+	if a.pre != nil && !a.pre(c) {
+		return c.node, c.replaced || c.deleted
+	}
+	if c.deleted {
+		return nil, true
+	}
+	changed := c.replaced
+	parent, orig := children(c.node)
+	if prog, ok := c.node.(*Program); ok {
+		orig = prog.exprs // top-level expressions have no parent node
+	}
+	if len(orig) > 0 {
+		items := make([]Expression, 0, len(orig))
+		itemsChanged := false
+		for i, x := range orig {
+			if a.stop {
+				items = append(items, orig[i:]...)
+				break
+			}
+			y, ch := a.apply(parent, i, x)
+			itemsChanged = itemsChanged || ch
+			if y != nil || !ch {
+				items = append(items, y)
+			}
+		}
+		if itemsChanged {
+			c.node = withChildren(c.node, items)
+			changed = true
+		}
+	}
+	if a.post != nil && !a.stop && !a.post(c) {
+		a.stop = true
+	}
+	return c.node, changed || c.replaced || c.deleted
+}
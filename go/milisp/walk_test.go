@@ -0,0 +1,252 @@
+package milisp_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/michurin/milisp/go/milisp"
+)
+
+type depthVisitor struct {
+	depth int
+	log   *[]string
+}
+
+func (v depthVisitor) Visit(e milisp.Expression) milisp.Visitor {
+	if e == nil {
+		*v.log = append(*v.log, fmt.Sprintf("%d:end", v.depth))
+		return nil
+	}
+	*v.log = append(*v.log, fmt.Sprintf("%d:%s", v.depth, e))
+	return depthVisitor{depth: v.depth + 1, log: v.log}
+}
+
+func TestWalk(t *testing.T) {
+	expr, err := milisp.Compile("(a (b) c)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := []string(nil)
+	milisp.Walk(depthVisitor{log: &log}, expr)
+	if fmt.Sprintf("%q", log) != `["0:[SYM:a@1:2 [SYM:b@1:5]@1:4 SYM:c@1:8]@1:1" "1:SYM:a@1:2" "2:end" `+
+		`"1:[SYM:b@1:5]@1:4" "2:SYM:b@1:5" "3:end" "2:end" "1:SYM:c@1:8" "2:end" "1:end"]` {
+		t.Errorf("Unexpected log: %q", log)
+	}
+	expr, err = milisp.Compile("[a {b 'c}]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log = nil
+	milisp.Walk(depthVisitor{log: &log}, expr)
+	if fmt.Sprintf("%q", log) != `["0:VEC:[SYM:a@1:2 MAP:[SYM:b@1:5 QUOTE:SYM:c@1:8@1:7]@1:4]@1:1" "1:SYM:a@1:2" "2:end" `+
+		`"1:MAP:[SYM:b@1:5 QUOTE:SYM:c@1:8@1:7]@1:4" "2:SYM:b@1:5" "3:end" "2:QUOTE:SYM:c@1:8@1:7" "3:end" "2:end" `+
+		`"1:end"]` {
+		t.Errorf("Unexpected log: %q", log)
+	}
+}
+
+func TestApply(t *testing.T) {
+	expr, err := milisp.Compile("(a (b x) (c x) d)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		pre  milisp.ApplyFunc
+		post milisp.ApplyFunc
+		res  string
+	}{
+		{
+			name: "nothing",
+			res:  "(a (b x) (c x) d)",
+		},
+		{
+			name: "delete",
+			pre: func(c *milisp.Cursor) bool {
+				if s, ok := c.Node().(*milisp.Symbol); ok && s.Name() == "x" {
+					c.Delete()
+				}
+				return true
+			},
+			res: "(a (b) (c) d)",
+		},
+		{
+			name: "skip",
+			pre: func(c *milisp.Cursor) bool {
+				if s, ok := c.Node().(*milisp.Symbol); ok && s.Name() == "x" {
+					c.Replace(milisp.NewSymbol("y", s.Position()))
+				}
+				l, ok := c.Node().(*milisp.List)
+				return !ok || l.Items()[0].(*milisp.Symbol).Name() != "b"
+			},
+			res: "(a (b x) (c y) d)",
+		},
+		{
+			name: "stop",
+			post: func(c *milisp.Cursor) bool {
+				if s, ok := c.Node().(*milisp.Symbol); ok && s.Name() == "x" {
+					c.Replace(milisp.NewSymbol("y", s.Position()))
+					return false
+				}
+				return true
+			},
+			res: "(a (b y) (c x) d)",
+		},
+		{
+			name: "parent",
+			pre: func(c *milisp.Cursor) bool {
+				if s, ok := c.Node().(*milisp.Symbol); ok && s.Name() == "x" {
+					c.Replace(milisp.NewVector([]milisp.Expression{s}, c.Parent().Position()))
+					return false
+				}
+				return true
+			},
+			res: "(a (b [x]) (c [x]) d)",
+		},
+		{
+			name: "root",
+			pre: func(c *milisp.Cursor) bool {
+				if c.Parent() == nil && c.Index() == -1 {
+					c.Delete()
+				}
+				return true
+			},
+			res: "<nil>",
+		},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			res := milisp.Apply(expr, c.pre, c.post)
+			text := "<nil>"
+			if res != nil {
+				text, err = milisp.Format(res)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if text != c.res {
+				t.Errorf("Unexpected result: %s", text)
+			}
+			orig, err := milisp.Format(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if orig != "(a (b x) (c x) d)" {
+				t.Errorf("Original tree changed: %s", orig)
+			}
+		})
+	}
+}
+
+func TestApply_program(t *testing.T) {
+	prog, err := milisp.CompileProgram("(old 1) (old 2) (drop)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexes := []int(nil)
+	res := milisp.Apply(prog, func(c *milisp.Cursor) bool {
+		if c.ParentNode() == nil {
+			indexes = append(indexes, c.Index())
+		}
+		if l, ok := c.Node().(*milisp.List); ok && l.Items()[0].(*milisp.Symbol).Name() == "drop" {
+			c.Delete()
+		}
+		if s, ok := c.Node().(*milisp.Symbol); ok && s.Name() == "old" {
+			c.Replace(milisp.NewSymbol("new", s.Position()))
+		}
+		return true
+	}, nil)
+	renamed, ok := res.(*milisp.Program)
+	if !ok {
+		t.Fatalf("Unexpected result: %T", res)
+	}
+	if renamed.String() != "[[SYM:new@1:2 INT:1@1:6]@1:1 [SYM:new@1:10 INT:2@1:14]@1:9]" || len(prog.Expressions()) != 3 {
+		t.Errorf("Unexpected programs: %s; %s", renamed, prog)
+	}
+	if fmt.Sprint(indexes) != "[-1 0 1 2]" {
+		t.Errorf("Unexpected indexes: %v", indexes)
+	}
+}
+
+func TestCursor_parent(t *testing.T) {
+	expr, err := milisp.Compile(`(a [x])`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents := []string(nil)
+	milisp.Apply(expr, func(c *milisp.Cursor) bool {
+		parents = append(parents, fmt.Sprintf("%v %v", c.Parent(), c.ParentNode()))
+		return true
+	}, nil)
+	text := strings.Join(parents, "\n")
+	expected := `<nil> <nil>
+[SYM:a@1:2 VEC:[SYM:x@1:5]@1:4]@1:1 [SYM:a@1:2 VEC:[SYM:x@1:5]@1:4]@1:1
+[SYM:a@1:2 VEC:[SYM:x@1:5]@1:4]@1:1 [SYM:a@1:2 VEC:[SYM:x@1:5]@1:4]@1:1
+<nil> VEC:[SYM:x@1:5]@1:4`
+	if text != expected {
+		t.Errorf("Unexpected parents:\n%s", text)
+	}
+}
+
+func ExampleInspect() {
+	expr, err := milisp.Compile(`(vector (and (in code UK) (in area LDN)) (in code IL))`)
+	if err != nil {
+		panic(err)
+	}
+	count := map[string]int{}
+	milisp.Inspect(expr, func(e milisp.Expression) bool {
+		if s, ok := e.(*milisp.Symbol); ok {
+			count[s.Name()]++
+		}
+		return true
+	})
+	fmt.Println(count)
+	// Output: map[IL:1 LDN:1 UK:1 and:1 area:1 code:2 in:3 vector:1]
+}
+
+func ExampleApply() {
+	expr, err := milisp.Compile(`(vector (and (in code UK) (in area LDN)) (in code IL))`)
+	if err != nil {
+		panic(err)
+	}
+	// rename feature and migrate operation
+	renamed := milisp.Apply(expr, func(c *milisp.Cursor) bool {
+		if s, ok := c.Node().(*milisp.Symbol); ok {
+			switch {
+			case s.Name() == "code":
+				c.Replace(milisp.NewSymbol("phoneCountryCode", s.Position()))
+			case s.Name() == "in" && c.Index() == 0:
+				c.Replace(milisp.NewSymbol("contains", s.Position()))
+			}
+		}
+		return true
+	}, nil)
+	// inject instrumentation: wrap every call of contains
+	instrumented := milisp.Apply(renamed, nil, func(c *milisp.Cursor) bool {
+		if l, ok := c.Node().(*milisp.List); ok {
+			if s, ok := l.Items()[0].(*milisp.Symbol); ok && s.Name() == "contains" {
+				c.Replace(milisp.NewList([]milisp.Expression{
+					milisp.NewSymbol("count", l.Position()),
+					l,
+				}, l.Position()))
+			}
+		}
+		return true
+	})
+	for _, e := range []milisp.Expression{expr, renamed, instrumented} {
+		text, err := milisp.Format(e)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(text)
+	}
+	// Output:
+	// (vector (and (in code UK) (in area LDN)) (in code IL))
+	// (vector
+	//   (and (contains phoneCountryCode UK) (contains area LDN))
+	//   (contains phoneCountryCode IL))
+	// (vector
+	//   (and (count (contains phoneCountryCode UK)) (count (contains area LDN)))
+	//   (count (contains phoneCountryCode IL)))
+}